@@ -20,6 +20,7 @@ import (
 	"strings"
 
 	"github.com/polynetwork/heco_relayer/config"
+	"github.com/polynetwork/heco_relayer/log"
 	"github.com/urfave/cli"
 )
 
@@ -30,6 +31,12 @@ var (
 		Value: config.DEFAULT_LOG_LEVEL,
 	}
 
+	LogFormatFlag = cli.StringFlag{
+		Name:  "logformat",
+		Usage: "Set the log format to `<format>`, text or json (one JSON object per line)",
+		Value: "text",
+	}
+
 	ConfigPathFlag = cli.StringFlag{
 		Name:  "cliconfig",
 		Usage: "Server config file `<path>`",
@@ -59,6 +66,45 @@ var (
 		Usage: "log directory",
 		Value: "./Log/",
 	}
+
+	LogMaxSizeFlag = cli.Int64Flag{
+		Name:  "logmaxsize",
+		Usage: "start a new log file when the current one exceeds `<MB>`",
+		Value: log.DEFAULT_MAX_LOG_SIZE,
+	}
+
+	LogMaxAgeFlag = cli.Uint64Flag{
+		Name:  "logmaxage",
+		Usage: "start a new log file every `<hours>`, 0 to rotate by size only",
+		Value: 24,
+	}
+
+	LogBackupsFlag = cli.IntFlag{
+		Name:  "logbackups",
+		Usage: "keep `<num>` rotated log files at most, 0 to keep all",
+		Value: 0,
+	}
+
+	LogCompressFlag = cli.BoolFlag{
+		Name:  "logcompress",
+		Usage: "gzip rotated log files",
+	}
+
+	TransferHashFlag = cli.StringFlag{
+		Name:  "hash",
+		Usage: "look the transfer up by `<txhash>` on heco or poly, or by the source tx id poly recorded for txs to heco",
+	}
+
+	TransferCidFlag = cli.StringFlag{
+		Name:  "cid",
+		Usage: "look the transfer up by `<from chain id>-<cross chain id>`, or by the cross chain id only",
+	}
+
+	TransferApiFlag = cli.StringFlag{
+		Name:  "api",
+		Usage: "base `<url>` of the api served by the running relayer",
+		Value: "http://localhost:6060",
+	}
 )
 
 //GetFlagName deal with short flag, and return the flag name whether flag name have short name
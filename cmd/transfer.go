@@ -0,0 +1,79 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/polynetwork/heco_relayer/db"
+	"github.com/urfave/cli"
+)
+
+var TransferCommand = cli.Command{
+	Name:   "transfer",
+	Usage:  "Show the lifecycle of cross chain transfers",
+	Action: showTransfers,
+	Flags: []cli.Flag{
+		TransferHashFlag,
+		TransferCidFlag,
+		TransferApiFlag,
+	},
+}
+
+// showTransfers asks the running relayer for the transfers
+func showTransfers(ctx *cli.Context) error {
+	hash := ctx.String(GetFlagName(TransferHashFlag))
+	cid := ctx.String(GetFlagName(TransferCidFlag))
+	if hash == "" && cid == "" {
+		return fmt.Errorf("either --hash or --cid is required")
+	}
+	transfers, err := queryTransfers(ctx.String(GetFlagName(TransferApiFlag)), hash, cid)
+	if err != nil {
+		return err
+	}
+	if len(transfers) == 0 {
+		return fmt.Errorf("transfer not found")
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(transfers)
+}
+
+func queryTransfers(api, hash, cid string) ([]*db.Transfer, error) {
+	resp, err := http.Get(strings.TrimSuffix(api, "/") + "/transfers?" + url.Values{"hash": {hash}, "cid": {cid}}.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the relayer at %s, is it running? %v", api, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNotFound:
+		transfers := make([]*db.Transfer, 0)
+		if err := json.NewDecoder(resp.Body).Decode(&transfers); err != nil {
+			return nil, fmt.Errorf("failed to decode transfers: %v", err)
+		}
+		return transfers, nil
+	default:
+		msg := make([]byte, 512)
+		n, _ := resp.Body.Read(msg)
+		return nil, fmt.Errorf("query transfers failed: %s %s", resp.Status, msg[:n])
+	}
+}
@@ -28,14 +28,43 @@ import (
 )
 
 const (
-	POLY_MONITOR_INTERVAL = 1 * time.Second
+	POLY_MONITOR_INTERVAL  = 1 * time.Second
+	BALANCE_CHECK_INTERVAL = 30 * time.Second
+	EPOCH_CHECK_INTERVAL   = 10 * time.Second
 
 	HECO_USEFUL_BLOCK_NUM    = 20
 	POLY_USEFUL_BLOCK_NUM    = 1
+	POLY_MAX_SCAN_BLOCKS     = 1000
 	DEFAULT_CONFIG_FILE_NAME = "./config.json"
 	Version                  = "1.0"
 
 	DEFAULT_LOG_LEVEL = log.InfoLog
+
+	DEFAULT_MAX_HEIGHT_LAG = 5
+
+	DEFAULT_HECO_STALL_TIMEOUT = 60 * time.Second
+	DEFAULT_POLY_STALL_TIMEOUT = 300 * time.Second
+
+	DEFAULT_HEARTBEAT_TIMEOUT   = 600 * time.Second
+	DEFAULT_HECO_MAX_CURSOR_LAG = 200
+	DEFAULT_POLY_MAX_CURSOR_LAG = 2000
+	DEFAULT_POLY_SCAN_WINDOW    = 8
+	DEFAULT_POLY_PROOF_FETCHES  = 16
+
+	DEFAULT_MAX_INFLIGHT_TXS = 8
+	DEFAULT_RELAYS_PER_TICK  = 10
+	DEFAULT_FEE_AGING_PERIOD = 600
+	DEFAULT_FEE_AGING_UNIT   = 1
+
+	DEFAULT_PROFIT_RECHECK_INTERVAL = 60
+	DEFAULT_PROFIT_MAX_DEFER_TIME   = 86400
+
+	DEFAULT_FEE_RECHECK_INTERVAL = 60
+	DEFAULT_FEE_RECHECK_EXPIRY   = 3600
+
+	DEFAULT_NOTIFY_THROTTLE = 600 * time.Second
+	DEFAULT_WEBHOOK_RETRIES = 5
+	DEFAULT_WEBHOOK_TIMEOUT = 10 * time.Second
 )
 
 //type ETH struct {
@@ -47,34 +76,136 @@ const (
 //}
 
 type ServiceConfig struct {
-	PolyConfig      *PolyConfig
-	HecoConfig      *HecoConfig
-	BridgeUrl       [][]string
-	BoltDbPath      string
-	RoutineNum      int64
-	TargetContracts []map[string]map[string][]uint64
+	PolyConfig         *PolyConfig
+	HecoConfig         *HecoConfig
+	BridgeUrl          [][]string
+	FeeMode            string          // bridge (default), allowlist or all
+	FeeAllowList       []*FeeAllowItem // txs from these source contracts are relayed without fee check
+	FeeRecheckInterval int64           // seconds between fee checks of a tx whose fee was not found paid
+	FeeRecheckExpiry   int64           // seconds after a tx was found before an unpaid tx is dropped
+	ProfitConfig       *ProfitConfig   // relay only txs whose fee covers the gas, disabled when nil
+	NotifyConfig       *NotifyConfig   // alerts on failures, disabled when nil
+	BoltDbPath         string
+	TargetContracts    []map[string]map[string][]uint64
+	LogLevels          map[string]int // log module => level, e.g. {"sender": 1}, others use --loglevel
+	HealthAddr         string         // address serving /healthz and /readyz, e.g. ":6061"
+	HeartbeatTimeout   uint64         // seconds a monitoring routine may stay silent before it is considered dead
+}
+
+// GetBridgeURLs returns all urls of BridgeUrl without duplicates
+func (this *ServiceConfig) GetBridgeURLs() []string {
+	urls := make([]string, 0)
+	for _, v := range this.BridgeUrl {
+		urls = append(urls, v...)
+	}
+	return uniqueURLs(urls)
+}
+
+// ProfitConfig compares paid fees with the heco gas cost in the unit fees are
+// paid in, HT is converted by HTPrice or the price read from PriceUrl
+type ProfitConfig struct {
+	Margin          float64 // the fee must be at least cost * (1 + Margin)
+	HTPrice         string  // price of one HT, used when PriceUrl is empty
+	PriceUrl        string  // JSON api giving the price of one HT
+	PricePath       string  // dot separated field of the price in the PriceUrl response, e.g. "data.price"
+	RecheckInterval uint64  // seconds before an unprofitable tx is checked again
+	MaxDeferTime    uint64  // seconds after it was found before an unprofitable tx is dead-lettered
+}
+
+type NotifyConfig struct {
+	Throttle uint64 // seconds before the same kind of event about the same subject is sent again
+	Webhooks []*WebhookConfig
+}
+
+type WebhookConfig struct {
+	Url        string
+	Secret     string   // key of the HMAC-SHA256 signature in the X-Signature-256 header, unsigned when empty
+	Template   string   // payload format: json (default), slack or a text/template rendering the event
+	Events     []string // kinds of events to send, all when empty
+	MaxRetries int      // retries with exponential backoff on failure
+	Timeout    uint64   // seconds to wait for the webhook to answer
+}
+
+type FeeAllowItem struct {
+	ChainId  uint64 // source chain
+	Contract string // source contract in hex
+}
+
+func (this *ServiceConfig) GetHeartbeatTimeout() time.Duration {
+	if this.HeartbeatTimeout == 0 {
+		return DEFAULT_HEARTBEAT_TIMEOUT
+	}
+	return time.Duration(this.HeartbeatTimeout) * time.Second
 }
 
 type PolyConfig struct {
 	RestURL                 string
+	RestURLs                []string // more poly endpoints to fail over to, RestURL is always the first one
+	MaxHeightLag            uint64   // endpoints lagging more blocks than this behind the highest one are avoided
+	StallTimeout            uint64   // seconds without a new block before poly is considered stalled
+	MaxCursorLag            uint64   // blocks the poly scanner may fall behind before the relayer is not ready
+	ScanWindow              uint64   // poly blocks fetched concurrently ahead of the one being handled
+	ProofFetches            uint64   // cross states proofs fetched concurrently at most, over all blocks
 	EntranceContractAddress string
 	WalletFile              string
 	WalletPwd               string
+	ProofWallets            []*PolyWalletConfig // extra wallets whose accounts only commit proofs
+}
+
+// GetRestURLs returns all configured poly endpoints without duplicates
+func (this *PolyConfig) GetRestURLs() []string {
+	return uniqueURLs(append([]string{this.RestURL}, this.RestURLs...))
+}
+
+type PolyWalletConfig struct {
+	WalletFile string
+	WalletPwd  string
 }
 
 type HecoConfig struct {
 	SideChainId            uint64
 	RestURL                string
+	RestURLs               []string // more heco endpoints to fail over to, RestURL is always the first one
+	RpcQuorum              int      // endpoints that must agree on headers used for header sync and proofs, 0 or 1 to disable
+	MaxHeightLag           uint64   // endpoints lagging more blocks than this behind the highest one are avoided
+	StallTimeout           uint64   // seconds without a new block before heco is considered stalled
+	MaxCursorLag           uint64   // blocks the heco scanner may fall behind before the relayer is not ready
 	ECCMContractAddress    string
 	ECCDContractAddress    string
 	KeyStorePath           string
 	KeyStorePwdSet         map[string]string
 	BlockConfig            uint64
 	CommitProofBlockConfig uint64 // heco chain should be 21, value should be always >= 21 for heco
+	ProofWorkerNum         int    // number of routines fetching and committing proofs to poly
 	HeadersPerBatch        int
 	MonitorInterval        uint64
 	EnableChangeBookKeeper bool
 	SkippedSenders         []string
+	MinSenderBalance       string             // HT, senders below it are not selected, defaults to the cost of one relay
+	SenderSelector         string             // balance (default), least_pending, round_robin or sticky
+	MaxInflightTxs         int                // txs of one sender sent but not confirmed yet at most
+	RelaysPerTick          int                // paid poly txs relayed per monitor tick at most
+	FeeAgingPeriod         int64              // seconds after which the priority of a waiting tx has grown by FeeAgingUnit
+	FeeAgingUnit           float64            // fee added to the priority of a waiting tx every FeeAgingPeriod
+	FeeWeights             map[string]float64 // destination contract => multiplier applied to its paid fees, 1 by default
+}
+
+// GetRestURLs returns all configured heco endpoints without duplicates
+func (this *HecoConfig) GetRestURLs() []string {
+	return uniqueURLs(append([]string{this.RestURL}, this.RestURLs...))
+}
+
+func uniqueURLs(list []string) []string {
+	urls := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, url := range list {
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		urls = append(urls, url)
+	}
+	return urls
 }
 
 type ONTConfig struct {
@@ -0,0 +1,125 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package db
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/boltdb/bolt"
+)
+
+// Batch stages queue inserts, deletes and cursor updates to be written in one
+// bolt transaction by Commit, so either all of them land or none does
+type Batch struct {
+	w   *BoltDB
+	ops []func(btx *bolt.Tx) error
+	err error // first error while staging, returned by Commit
+}
+
+func (w *BoltDB) NewBatch() *Batch {
+	return &Batch{w: w}
+}
+
+func (b *Batch) put(bkt []byte, k, v []byte) {
+	b.ops = append(b.ops, func(btx *bolt.Tx) error {
+		return btx.Bucket(bkt).Put(k, v)
+	})
+}
+
+func (b *Batch) delete(bkt []byte, k []byte) {
+	b.ops = append(b.ops, func(btx *bolt.Tx) error {
+		return btx.Bucket(bkt).Delete(k)
+	})
+}
+
+// hexKey decodes txHash, a bad one fails the whole batch
+func (b *Batch) hexKey(txHash string) ([]byte, bool) {
+	k, err := hex.DecodeString(txHash)
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return nil, false
+	}
+	return k, true
+}
+
+func (b *Batch) PutCheck(txHash string, v []byte) {
+	if k, ok := b.hexKey(txHash); ok {
+		b.put(BKTCheck, k, v)
+	}
+}
+
+func (b *Batch) DeleteCheck(txHash string) {
+	if k, ok := b.hexKey(txHash); ok {
+		b.delete(BKTCheck, k)
+	}
+}
+
+func (b *Batch) PutRetry(k []byte) {
+	b.put(BKTRetry, k, []byte{0x00})
+}
+
+func (b *Batch) DeleteRetry(k []byte) {
+	b.delete(BKTRetry, k)
+}
+
+func (b *Batch) PutBridgeTransactions(txHash string, v []byte) {
+	if k, ok := b.hexKey(txHash); ok {
+		b.put(BKTBridgeTransactions, k, v)
+	}
+}
+
+func (b *Batch) DeleteBridgeTransactions(txHash string) {
+	if k, ok := b.hexKey(txHash); ok {
+		b.delete(BKTBridgeTransactions, k)
+	}
+}
+
+func (b *Batch) UpdatePolyHeight(h uint32) {
+	raw := make([]byte, 4)
+	binary.LittleEndian.PutUint32(raw, h)
+	b.put(BKTHeight, []byte("poly_height"), raw)
+}
+
+// Len returns the number of staged writes
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Commit writes everything staged in one transaction, nothing is written on error
+func (b *Batch) Commit() error {
+	if b.err != nil {
+		return b.err
+	}
+	if len(b.ops) == 0 {
+		return nil
+	}
+	dbLog.Debugf("Commit - %d writes", len(b.ops))
+	b.w.rwlock.Lock()
+	defer b.w.rwlock.Unlock()
+
+	return b.w.db.Update(func(btx *bolt.Tx) error {
+		for _, op := range b.ops {
+			if err := op(btx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -17,6 +17,7 @@
 package db
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
@@ -25,15 +26,22 @@ import (
 	"sync"
 
 	"github.com/boltdb/bolt"
+	"github.com/polynetwork/heco_relayer/log"
 )
 
 const MAX_NUM = 1000
 
+var dbLog = log.NewModule("db")
+
 var (
 	BKTCheck              = []byte("Check")
 	BKTRetry              = []byte("Retry")
 	BKTHeight             = []byte("Height")
 	BKTBridgeTransactions = []byte("Bridge Transactions")
+	BKTSenderTxs          = []byte("Sender Transactions")
+	BKTDeadLetters        = []byte("Dead Letters")
+	BKTTransfers          = []byte("Transfers")
+	BKTTransferHashes     = []byte("Transfer Hashes")
 )
 
 type BoltDB struct {
@@ -42,10 +50,15 @@ type BoltDB struct {
 	filePath string
 }
 
-func NewBoltDB(filePath string) (*BoltDB, error) {
+func dbFile(filePath string) string {
 	if !strings.Contains(filePath, ".bin") {
 		filePath = path.Join(filePath, "bolt.bin")
 	}
+	return filePath
+}
+
+func NewBoltDB(filePath string) (*BoltDB, error) {
+	filePath = dbFile(filePath)
 	w := new(BoltDB)
 	db, err := bolt.Open(filePath, 0644, &bolt.Options{InitialMmapSize: 500000})
 	if err != nil {
@@ -97,11 +110,47 @@ func NewBoltDB(filePath string) (*BoltDB, error) {
 	}); err != nil {
 		return nil, err
 	}
+	if err = db.Update(func(btx *bolt.Tx) error {
+		_, err := btx.CreateBucketIfNotExists(BKTSenderTxs)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err = db.Update(func(btx *bolt.Tx) error {
+		_, err := btx.CreateBucketIfNotExists(BKTDeadLetters)
+		if err != nil {
+			return err
+		}
 
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err = db.Update(func(btx *bolt.Tx) error {
+		_, err := btx.CreateBucketIfNotExists(BKTTransfers)
+		if err != nil {
+			return err
+		}
+		_, err = btx.CreateBucketIfNotExists(BKTTransferHashes)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	dbLog.Infof("NewBoltDB - opened %s", filePath)
 	return w, nil
 }
 
 func (w *BoltDB) PutCheck(txHash string, v []byte) error {
+	dbLog.Debugf("PutCheck - poly tx %s", txHash)
 	w.rwlock.Lock()
 	defer w.rwlock.Unlock()
 
@@ -121,6 +170,7 @@ func (w *BoltDB) PutCheck(txHash string, v []byte) error {
 }
 
 func (w *BoltDB) DeleteCheck(txHash string) error {
+	dbLog.Debugf("DeleteCheck - poly tx %s", txHash)
 	w.rwlock.Lock()
 	defer w.rwlock.Unlock()
 
@@ -139,6 +189,7 @@ func (w *BoltDB) DeleteCheck(txHash string) error {
 }
 
 func (w *BoltDB) PutRetry(k []byte) error {
+	dbLog.Debugf("PutRetry - %d bytes", len(k))
 	w.rwlock.Lock()
 	defer w.rwlock.Unlock()
 
@@ -154,6 +205,7 @@ func (w *BoltDB) PutRetry(k []byte) error {
 }
 
 func (w *BoltDB) DeleteRetry(k []byte) error {
+	dbLog.Debugf("DeleteRetry - %d bytes", len(k))
 	w.rwlock.Lock()
 	defer w.rwlock.Unlock()
 
@@ -249,6 +301,7 @@ func (w *BoltDB) GetPolyHeight() uint32 {
 }
 
 func (w *BoltDB) PutBridgeTransactions(txHash string, v []byte) error {
+	dbLog.Debugf("PutBridgeTransactions - tx %s", txHash)
 	w.rwlock.Lock()
 	defer w.rwlock.Unlock()
 	k, err := hex.DecodeString(txHash)
@@ -267,6 +320,7 @@ func (w *BoltDB) PutBridgeTransactions(txHash string, v []byte) error {
 }
 
 func (w *BoltDB) DeleteBridgeTransactions(txHash string) error {
+	dbLog.Debugf("DeleteBridgeTransactions - tx %s", txHash)
 	w.rwlock.Lock()
 	defer w.rwlock.Unlock()
 	k, err := hex.DecodeString(txHash)
@@ -309,6 +363,96 @@ func (w *BoltDB) GetAllBridgeTransactions() (map[string][]byte, error) {
 	return checkMap, nil
 }
 
+// PutDeadLetter keeps a bridge transaction that will not be relayed anymore
+func (w *BoltDB) PutDeadLetter(txHash string, v []byte) error {
+	dbLog.Debugf("PutDeadLetter - tx %s", txHash)
+	w.rwlock.Lock()
+	defer w.rwlock.Unlock()
+	k, err := hex.DecodeString(txHash)
+	if err != nil {
+		return err
+	}
+	return w.db.Update(func(btx *bolt.Tx) error {
+		bucket := btx.Bucket(BKTDeadLetters)
+		return bucket.Put(k, v)
+	})
+}
+
+// SenderTx is a transaction queued for a heco sender, Seq keeps the order
+type SenderTx struct {
+	Seq uint64
+	Raw []byte
+}
+
+func senderTxKey(sender []byte, seq uint64) []byte {
+	k := make([]byte, len(sender)+8)
+	copy(k, sender)
+	binary.BigEndian.PutUint64(k[len(sender):], seq)
+	return k
+}
+
+func (w *BoltDB) PutSenderTx(sender []byte, seq uint64, v []byte) error {
+	dbLog.Debugf("PutSenderTx - sender %x, seq %d", sender, seq)
+	w.rwlock.Lock()
+	defer w.rwlock.Unlock()
+
+	return w.db.Update(func(btx *bolt.Tx) error {
+		bucket := btx.Bucket(BKTSenderTxs)
+		return bucket.Put(senderTxKey(sender, seq), v)
+	})
+}
+
+func (w *BoltDB) DeleteSenderTx(sender []byte, seq uint64) error {
+	dbLog.Debugf("DeleteSenderTx - sender %x, seq %d", sender, seq)
+	w.rwlock.Lock()
+	defer w.rwlock.Unlock()
+
+	return w.db.Update(func(btx *bolt.Tx) error {
+		bucket := btx.Bucket(BKTSenderTxs)
+		return bucket.Delete(senderTxKey(sender, seq))
+	})
+}
+
+// GetSenderTxs returns all transactions queued for sender ordered by Seq
+func (w *BoltDB) GetSenderTxs(sender []byte) ([]*SenderTx, error) {
+	w.rwlock.RLock()
+	defer w.rwlock.RUnlock()
+
+	list := make([]*SenderTx, 0)
+	err := w.db.View(func(btx *bolt.Tx) error {
+		c := btx.Bucket(BKTSenderTxs).Cursor()
+		for k, v := c.Seek(sender); k != nil && bytes.HasPrefix(k, sender); k, v = c.Next() {
+			if len(k) != len(sender)+8 {
+				continue
+			}
+			_v := make([]byte, len(v))
+			copy(_v, v)
+			list = append(list, &SenderTx{
+				Seq: binary.BigEndian.Uint64(k[len(sender):]),
+				Raw: _v,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Check makes sure the db file is still open and readable
+func (w *BoltDB) Check() error {
+	w.rwlock.RLock()
+	defer w.rwlock.RUnlock()
+
+	return w.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(BKTHeight) == nil {
+			return fmt.Errorf("bucket %s not found", string(BKTHeight))
+		}
+		return nil
+	})
+}
+
 func (w *BoltDB) Close() {
 	w.rwlock.Lock()
 	w.db.Close()
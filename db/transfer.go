@@ -0,0 +1,229 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+type TransferState string
+
+const (
+	TRANSFER_DETECTED        TransferState = "detected"        // found on heco, or on poly for txs to heco
+	TRANSFER_PROOF_SUBMITTED TransferState = "proof-submitted" // proof of the heco tx sent to poly
+	TRANSFER_POLY_CONFIRMED  TransferState = "poly-confirmed"
+	TRANSFER_POLY_FAILED     TransferState = "poly-failed" // the proof will be submitted again
+	TRANSFER_RELAYED         TransferState = "relayed-to-heco"
+	TRANSFER_HECO_CONFIRMED  TransferState = "heco-confirmed"
+	TRANSFER_DROPPED         TransferState = "dropped"
+)
+
+// MAX_TRANSFER_EVENTS limits the history of a transfer, only the latest events are kept
+const MAX_TRANSFER_EVENTS = 32
+
+type TransferEvent struct {
+	State  TransferState
+	Time   int64
+	TxHash string `json:",omitempty"`
+	Desc   string `json:",omitempty"`
+}
+
+// Transfer is the lifecycle of one cross chain transfer handled by the relayer
+type Transfer struct {
+	FromChainId  uint64
+	ToChainId    uint64
+	CrossChainId string
+	SrcTxHash    string `json:",omitempty"` // tx on the source chain, only known for txs from heco
+	SrcTxId      string `json:",omitempty"` // tx hash of the source chain recorded by poly, the cross chain tx index for EVM chains
+	PolyTxHash   string `json:",omitempty"`
+	DstTxHash    string `json:",omitempty"` // tx relayed to heco
+	State        TransferState
+	CreateTime   int64
+	UpdateTime   int64
+	Events       []*TransferEvent
+}
+
+// TransferUpdate moves a transfer to State, empty fields keep their values
+type TransferUpdate struct {
+	FromChainId  uint64
+	ToChainId    uint64
+	CrossChainId []byte
+	SrcTxHash    string
+	SrcTxId      string
+	PolyTxHash   string
+	DstTxHash    string
+	State        TransferState
+	Desc         string
+}
+
+func transferKey(fromChainId uint64, crossChainId []byte) []byte {
+	k := make([]byte, len(crossChainId)+8)
+	copy(k, crossChainId)
+	binary.BigEndian.PutUint64(k[len(crossChainId):], fromChainId)
+	return k
+}
+
+// hashKey indexes tx hashes case and prefix insensitive
+func hashKey(txHash string) []byte {
+	return []byte(strings.TrimPrefix(strings.ToLower(txHash), "0x"))
+}
+
+// UpdateTransfer applies u to the transfer it belongs to, creating it on the
+// first update, and indexes the tx hashes of u
+func (w *BoltDB) UpdateTransfer(u *TransferUpdate) error {
+	dbLog.Debugf("UpdateTransfer - transfer %d-%x, state %s", u.FromChainId, u.CrossChainId, u.State)
+	if len(u.CrossChainId) == 0 {
+		return fmt.Errorf("UpdateTransfer - no cross chain id")
+	}
+	w.rwlock.Lock()
+	defer w.rwlock.Unlock()
+
+	k := transferKey(u.FromChainId, u.CrossChainId)
+	now := time.Now().Unix()
+	return w.db.Update(func(btx *bolt.Tx) error {
+		bucket := btx.Bucket(BKTTransfers)
+		t := &Transfer{
+			FromChainId:  u.FromChainId,
+			CrossChainId: hex.EncodeToString(u.CrossChainId),
+			CreateTime:   now,
+		}
+		if v := bucket.Get(k); v != nil {
+			if err := json.Unmarshal(v, t); err != nil {
+				return err
+			}
+		}
+		if u.ToChainId != 0 {
+			t.ToChainId = u.ToChainId
+		}
+		event := &TransferEvent{State: u.State, Time: now, Desc: u.Desc}
+		index := btx.Bucket(BKTTransferHashes)
+		for _, h := range []struct {
+			update string
+			field  *string
+		}{{u.SrcTxHash, &t.SrcTxHash}, {u.SrcTxId, &t.SrcTxId}, {u.PolyTxHash, &t.PolyTxHash}, {u.DstTxHash, &t.DstTxHash}} {
+			if h.update == "" {
+				continue
+			}
+			*h.field = h.update
+			event.TxHash = h.update
+			if err := index.Put(hashKey(h.update), k); err != nil {
+				return err
+			}
+		}
+		t.State = u.State
+		t.UpdateTime = now
+		t.Events = append(t.Events, event)
+		if len(t.Events) > MAX_TRANSFER_EVENTS {
+			t.Events = t.Events[len(t.Events)-MAX_TRANSFER_EVENTS:]
+		}
+		v, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(k, v)
+	})
+}
+
+// FindTransfers looks transfers up by any of their tx hashes or their source
+// tx id, or by cid which is either "<from chain id>-<cross chain id>" as in
+// the logs or a bare cross chain id matching transfers from all chains
+func (w *BoltDB) FindTransfers(txHash, cid string) ([]*Transfer, error) {
+	var (
+		crossChainId []byte
+		fromChainId  uint64
+		anyChain     = true
+		err          error
+	)
+	if cid != "" {
+		if i := strings.Index(cid, "-"); i >= 0 {
+			fromChainId, err = strconv.ParseUint(cid[:i], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid chain id in %s: %v", cid, err)
+			}
+			anyChain = false
+			cid = cid[i+1:]
+		}
+		crossChainId, err = hex.DecodeString(strings.TrimPrefix(cid, "0x"))
+		if err != nil || len(crossChainId) == 0 {
+			return nil, fmt.Errorf("invalid cross chain id %s", cid)
+		}
+	} else if txHash == "" {
+		return nil, fmt.Errorf("either tx hash or cid is required")
+	}
+
+	w.rwlock.RLock()
+	defer w.rwlock.RUnlock()
+
+	list := make([]*Transfer, 0)
+	err = w.db.View(func(btx *bolt.Tx) error {
+		bucket := btx.Bucket(BKTTransfers)
+		if bucket == nil {
+			return nil
+		}
+		add := func(v []byte) error {
+			t := new(Transfer)
+			if err := json.Unmarshal(v, t); err != nil {
+				return err
+			}
+			list = append(list, t)
+			return nil
+		}
+		if txHash != "" {
+			k := btx.Bucket(BKTTransferHashes).Get(hashKey(txHash))
+			if k == nil {
+				return nil
+			}
+			if crossChainId != nil && (len(k) != len(crossChainId)+8 || !bytes.HasPrefix(k, crossChainId) ||
+				!anyChain && binary.BigEndian.Uint64(k[len(crossChainId):]) != fromChainId) {
+				return nil
+			}
+			if v := bucket.Get(k); v != nil {
+				return add(v)
+			}
+			return nil
+		}
+		if !anyChain {
+			if v := bucket.Get(transferKey(fromChainId, crossChainId)); v != nil {
+				return add(v)
+			}
+			return nil
+		}
+		c := bucket.Cursor()
+		for k, v := c.Seek(crossChainId); k != nil && bytes.HasPrefix(k, crossChainId); k, v = c.Next() {
+			if len(k) != len(crossChainId)+8 {
+				continue
+			}
+			if err := add(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,190 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Check reports nil when the checked component is fine
+type Check func() error
+
+type heartbeat struct {
+	last    time.Time
+	timeout time.Duration
+}
+
+type Result struct {
+	Name  string
+	OK    bool
+	Error string `json:",omitempty"`
+}
+
+type Report struct {
+	OK      bool
+	Results []*Result
+}
+
+// Registry collects heartbeats of long running routines, liveness checks
+// served on /healthz and readiness checks served on /readyz.
+type Registry struct {
+	heartbeats map[string]*heartbeat
+	liveness   map[string]Check
+	readiness  map[string]Check
+	lock       sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		heartbeats: make(map[string]*heartbeat),
+		liveness:   make(map[string]Check),
+		readiness:  make(map[string]Check),
+	}
+}
+
+var Default = NewRegistry()
+
+// Register starts tracking a routine that must call Beat at least once per timeout
+func (this *Registry) Register(name string, timeout time.Duration) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.heartbeats[name] = &heartbeat{last: time.Now(), timeout: timeout}
+}
+
+func (this *Registry) Beat(name string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if hb, ok := this.heartbeats[name]; ok {
+		hb.last = time.Now()
+	}
+}
+
+func (this *Registry) AddLiveness(name string, check Check) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.liveness[name] = check
+}
+
+func (this *Registry) AddReadiness(name string, check Check) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.readiness[name] = check
+}
+
+func (this *Registry) heartbeatResults() []*Result {
+	results := make([]*Result, 0)
+	for name, hb := range this.heartbeats {
+		res := &Result{Name: "heartbeat:" + name, OK: true}
+		if silence := time.Since(hb.last); silence > hb.timeout {
+			res.OK = false
+			res.Error = "no heartbeat for " + silence.Round(time.Second).String()
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func runChecks(checks map[string]Check) []*Result {
+	results := make([]*Result, 0)
+	for name, check := range checks {
+		res := &Result{Name: name, OK: true}
+		if err := check(); err != nil {
+			res.OK = false
+			res.Error = err.Error()
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func newReport(results []*Result) *Report {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	report := &Report{OK: true, Results: results}
+	for _, res := range results {
+		if !res.OK {
+			report.OK = false
+		}
+	}
+	return report
+}
+
+func (this *Registry) snapshot() ([]*Result, map[string]Check, map[string]Check) {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	liveness := make(map[string]Check, len(this.liveness))
+	for k, v := range this.liveness {
+		liveness[k] = v
+	}
+	readiness := make(map[string]Check, len(this.readiness))
+	for k, v := range this.readiness {
+		readiness[k] = v
+	}
+	return this.heartbeatResults(), liveness, readiness
+}
+
+// Liveness covers heartbeats and liveness checks
+func (this *Registry) Liveness() *Report {
+	heartbeats, liveness, _ := this.snapshot()
+	return newReport(append(heartbeats, runChecks(liveness)...))
+}
+
+// Readiness covers everything in Liveness plus the readiness checks
+func (this *Registry) Readiness() *Report {
+	heartbeats, liveness, readiness := this.snapshot()
+	results := append(heartbeats, runChecks(liveness)...)
+	return newReport(append(results, runChecks(readiness)...))
+}
+
+func serveReport(w http.ResponseWriter, report *Report) {
+	w.Header().Set("Content-Type", "application/json")
+	if !report.OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// HandleFuncs registers /healthz and /readyz on mux
+func (this *Registry) HandleFuncs(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		serveReport(w, this.Liveness())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		serveReport(w, this.Readiness())
+	})
+}
+
+func Register(name string, timeout time.Duration) {
+	Default.Register(name, timeout)
+}
+
+func Beat(name string) {
+	Default.Beat(name)
+}
+
+func AddLiveness(name string, check Check) {
+	Default.AddLiveness(name, check)
+}
+
+func AddReadiness(name string, check Check) {
+	Default.AddReadiness(name, check)
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package log
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	TextFormat = iota
+	JSONFormat
+)
+
+const CORRELATION_ID = "cid"
+
+var levelKeys = map[int]string{
+	TraceLog: "trace",
+	DebugLog: "debug",
+	InfoLog:  "info",
+	WarnLog:  "warn",
+	ErrorLog: "error",
+	FatalLog: "fatal",
+}
+
+// Field is a typed key value pair attached to a log line
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Uint64(key string, value uint64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Hex(key string, value []byte) Field {
+	return Field{Key: key, Value: hex.EncodeToString(value)}
+}
+
+func Err(err error) Field {
+	if err == nil {
+		return Field{Key: "error", Value: nil}
+	}
+	return Field{Key: "error", Value: err.Error()}
+}
+
+// CorrelationID identifies one cross chain transfer by its source chain and
+// cross chain id, it is the same in every log line of the transfer
+func CorrelationID(fromChainId uint64, crossChainId []byte) Field {
+	return Field{Key: CORRELATION_ID, Value: fmt.Sprintf("%d-%s", fromChainId, hex.EncodeToString(crossChainId))}
+}
+
+func ParseFormat(name string) (int, error) {
+	switch strings.ToLower(name) {
+	case "", "text":
+		return TextFormat, nil
+	case "json":
+		return JSONFormat, nil
+	default:
+		return 0, fmt.Errorf("unknown log format %s", name)
+	}
+}
+
+func formatText(msg string, fields []Field) string {
+	if len(fields) == 0 {
+		return msg
+	}
+	buf := bytes.NewBufferString(msg)
+	for _, f := range fields {
+		fmt.Fprintf(buf, " %s=%v", f.Key, f.Value)
+	}
+	return buf.String()
+}
+
+// formatJSON renders one JSON line, the fixed keys come first
+func formatJSON(level int, msg string, fields []Field) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString(`{"time":`)
+	writeJSON(buf, time.Now().Format("2006-01-02T15:04:05.000000Z07:00"))
+	buf.WriteString(`,"level":`)
+	writeJSON(buf, levelKeys[level])
+	buf.WriteString(`,"gid":`)
+	writeJSON(buf, GetGID())
+	buf.WriteString(`,"msg":`)
+	writeJSON(buf, strings.TrimSuffix(msg, "\n"))
+	for _, f := range fields {
+		buf.WriteByte(',')
+		writeJSON(buf, f.Key)
+		buf.WriteByte(':')
+		writeJSON(buf, f.Value)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		raw, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(raw)
+}
+
+// Entry carries fields added to every line logged through it
+type Entry struct {
+	module *Module
+	fields []Field
+}
+
+func With(fields ...Field) *Entry {
+	return &Entry{fields: fields}
+}
+
+func (e *Entry) With(fields ...Field) *Entry {
+	all := make([]Field, 0, len(e.fields)+len(fields))
+	return &Entry{module: e.module, fields: append(append(all, e.fields...), fields...)}
+}
+
+func (e *Entry) output(level int, format string, a ...interface{}) {
+	if e.module != nil {
+		e.module.output(level, e.fields, format, a...)
+		return
+	}
+	Log.OutputFields(level, e.fields, format, a...)
+}
+
+func (e *Entry) Debugf(format string, a ...interface{}) {
+	e.output(DebugLog, format, a...)
+}
+
+func (e *Entry) Infof(format string, a ...interface{}) {
+	e.output(InfoLog, format, a...)
+}
+
+func (e *Entry) Warnf(format string, a ...interface{}) {
+	e.output(WarnLog, format, a...)
+}
+
+func (e *Entry) Errorf(format string, a ...interface{}) {
+	e.output(ErrorLog, format, a...)
+}
@@ -30,6 +30,8 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -113,30 +115,50 @@ func NameLevel(name string) int {
 }
 
 type Logger struct {
-	level   int
+	level   int32 // read and written atomically, it can be changed at runtime
+	format  int
 	logger  *log.Logger
 	logFile *os.File
+	rotator *RotateFile
+	lock    sync.Mutex // serializes JSON lines, text lines are serialized by logger
 }
 
 func New(out io.Writer, prefix string, flag, level int, file *os.File) *Logger {
 	return &Logger{
-		level:   level,
+		level:   int32(level),
+		format:  logFormat,
 		logger:  log.New(out, prefix, flag),
 		logFile: file,
 	}
 }
 
+// logFormat is kept for loggers created by later InitLog calls
+var logFormat = TextFormat
+
+// SetFormat switches between TextFormat and JSONFormat
+func SetFormat(format int) {
+	logFormat = format
+	Log.format = format
+}
+
 func (l *Logger) SetDebugLevel(level int) error {
 	if level > MaxLevelLog || level < 0 {
 		return errors.New("Invalid Debug Level")
 	}
 
-	l.level = level
+	atomic.StoreInt32(&l.level, int32(level))
 	return nil
 }
 
+func (l *Logger) Level() int {
+	return int(atomic.LoadInt32(&l.level))
+}
+
 func (l *Logger) Output(level int, a ...interface{}) error {
-	if level >= l.level {
+	if level >= l.Level() && l.format == JSONFormat {
+		return l.writeJSON(level, fmt.Sprintln(a...), nil)
+	}
+	if level >= l.Level() {
 		gid := GetGID()
 		gidStr := strconv.FormatUint(gid, 10)
 
@@ -149,7 +171,10 @@ func (l *Logger) Output(level int, a ...interface{}) error {
 }
 
 func (l *Logger) Outputf(level int, format string, v ...interface{}) error {
-	if level >= l.level {
+	if level >= l.Level() && l.format == JSONFormat {
+		return l.writeJSON(level, fmt.Sprintf(format, v...), nil)
+	}
+	if level >= l.Level() {
 		gid := GetGID()
 		v = append([]interface{}{LevelName(level), "GID",
 			gid}, v...)
@@ -159,6 +184,31 @@ func (l *Logger) Outputf(level int, format string, v ...interface{}) error {
 	return nil
 }
 
+// OutputFields logs the message with fields, as key=value pairs after the
+// message in TextFormat and as keys of the line in JSONFormat
+func (l *Logger) OutputFields(level int, fields []Field, format string, v ...interface{}) error {
+	if level < l.Level() {
+		return nil
+	}
+	return l.outputFields(level, fields, format, v...)
+}
+
+// outputFields logs without checking the level, modules check their own
+func (l *Logger) outputFields(level int, fields []Field, format string, v ...interface{}) error {
+	msg := fmt.Sprintf(format, v...)
+	if l.format == JSONFormat {
+		return l.writeJSON(level, msg, fields)
+	}
+	return l.logger.Output(CALL_DEPTH+2, fmt.Sprintf("%s %s %d, %s\n", LevelName(level), "GID", GetGID(), formatText(msg, fields)))
+}
+
+func (l *Logger) writeJSON(level int, msg string, fields []Field) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, err := l.logger.Writer().Write(formatJSON(level, msg, fields))
+	return err
+}
+
 func (l *Logger) Trace(a ...interface{}) {
 	l.Output(TraceLog, a...)
 }
@@ -208,7 +258,7 @@ func (l *Logger) Fatalf(format string, a ...interface{}) {
 }
 
 func Trace(a ...interface{}) {
-	if TraceLog < Log.level {
+	if TraceLog < Log.Level() {
 		return
 	}
 
@@ -228,7 +278,7 @@ func Trace(a ...interface{}) {
 }
 
 func Tracef(format string, a ...interface{}) {
-	if TraceLog < Log.level {
+	if TraceLog < Log.Level() {
 		return
 	}
 
@@ -248,7 +298,7 @@ func Tracef(format string, a ...interface{}) {
 }
 
 func Debug(a ...interface{}) {
-	if DebugLog < Log.level {
+	if DebugLog < Log.Level() {
 		return
 	}
 
@@ -264,7 +314,7 @@ func Debug(a ...interface{}) {
 }
 
 func Debugf(format string, a ...interface{}) {
-	if DebugLog < Log.level {
+	if DebugLog < Log.Level() {
 		return
 	}
 
@@ -341,7 +391,7 @@ func Init(a ...interface{}) {
 
 func InitLog(logLevel int, a ...interface{}) {
 	writers := []io.Writer{}
-	var logFile *os.File
+	var rotator *RotateFile
 	var err error
 	if len(a) == 0 {
 		writers = append(writers, ioutil.Discard)
@@ -349,12 +399,12 @@ func InitLog(logLevel int, a ...interface{}) {
 		for _, o := range a {
 			switch o.(type) {
 			case string:
-				logFile, err = FileOpen(o.(string))
+				rotator, err = NewRotateFile(o.(string), rotateConfig)
 				if err != nil {
 					fmt.Println("error: open log file failed")
 					os.Exit(1)
 				}
-				writers = append(writers, logFile)
+				writers = append(writers, rotator)
 			case *os.File:
 				writers = append(writers, o.(*os.File))
 			default:
@@ -364,10 +414,17 @@ func InitLog(logLevel int, a ...interface{}) {
 		}
 	}
 	fileAndStdoutWrite := io.MultiWriter(writers...)
-	Log = New(fileAndStdoutWrite, "", log.Ldate|log.Lmicroseconds, logLevel, logFile)
+	Log = New(fileAndStdoutWrite, "", log.Ldate|log.Lmicroseconds, logLevel, nil)
+	Log.rotator = rotator
 }
 
 func GetLogFileSize() (int64, error) {
+	if Log.rotator != nil {
+		return Log.rotator.Size(), nil
+	}
+	if Log.logFile == nil {
+		return 0, errors.New("no log file")
+	}
 	f, e := Log.logFile.Stat()
 	if e != nil {
 		return 0, e
@@ -385,7 +442,7 @@ func GetMaxLogChangeInterval(maxLogSize int64) int64 {
 
 func CheckIfNeedNewFile() bool {
 	logFileSize, err := GetLogFileSize()
-	maxLogFileSize := GetMaxLogChangeInterval(0)
+	maxLogFileSize := GetMaxLogChangeInterval(rotateConfig.MaxSize)
 	if err != nil {
 		return false
 	}
@@ -398,6 +455,9 @@ func CheckIfNeedNewFile() bool {
 
 func ClosePrintLog() error {
 	var err error
+	if Log.rotator != nil {
+		err = Log.rotator.Close()
+	}
 	if Log.logFile != nil {
 		err = Log.logFile.Close()
 	}
@@ -0,0 +1,173 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// INHERIT_LEVEL makes a module log at the level of Log
+const INHERIT_LEVEL = -1
+
+// Module is a named logger of a subsystem with its own level
+type Module struct {
+	name  string
+	level int32
+}
+
+var (
+	modules     = make(map[string]*Module)
+	modulesLock sync.RWMutex
+)
+
+// NewModule returns the module called name, creating it at INHERIT_LEVEL
+func NewModule(name string) *Module {
+	modulesLock.Lock()
+	defer modulesLock.Unlock()
+	if m, ok := modules[name]; ok {
+		return m
+	}
+	m := &Module{name: name, level: INHERIT_LEVEL}
+	modules[name] = m
+	return m
+}
+
+func (m *Module) Name() string {
+	return m.name
+}
+
+// Level returns the level of the module, or the one of Log when inherited
+func (m *Module) Level() int {
+	if level := atomic.LoadInt32(&m.level); level != INHERIT_LEVEL {
+		return int(level)
+	}
+	return Log.Level()
+}
+
+func (m *Module) SetLevel(level int) error {
+	if level != INHERIT_LEVEL && (level > MaxLevelLog || level < 0) {
+		return fmt.Errorf("invalid level %d", level)
+	}
+	atomic.StoreInt32(&m.level, int32(level))
+	return nil
+}
+
+func (m *Module) output(level int, fields []Field, format string, a ...interface{}) {
+	if level < m.Level() {
+		return
+	}
+	fields = append([]Field{String("module", m.name)}, fields...)
+	Log.outputFields(level, fields, format, a...)
+}
+
+func (m *Module) Debugf(format string, a ...interface{}) {
+	m.output(DebugLog, nil, format, a...)
+}
+
+func (m *Module) Infof(format string, a ...interface{}) {
+	m.output(InfoLog, nil, format, a...)
+}
+
+func (m *Module) Warnf(format string, a ...interface{}) {
+	m.output(WarnLog, nil, format, a...)
+}
+
+func (m *Module) Errorf(format string, a ...interface{}) {
+	m.output(ErrorLog, nil, format, a...)
+}
+
+func (m *Module) Fatalf(format string, a ...interface{}) {
+	m.output(FatalLog, nil, format, a...)
+}
+
+// With returns an Entry logging through the module
+func (m *Module) With(fields ...Field) *Entry {
+	return &Entry{module: m, fields: fields}
+}
+
+// SetModuleLevel changes the level of the module called name, "" or "global"
+// changes the level of Log that modules inherit by default
+func SetModuleLevel(name string, level int) error {
+	if name == "" || name == "global" {
+		return Log.SetDebugLevel(level)
+	}
+	modulesLock.RLock()
+	m, ok := modules[name]
+	modulesLock.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown log module %s", name)
+	}
+	return m.SetLevel(level)
+}
+
+type ModuleLevel struct {
+	Module    string
+	Level     int
+	Inherited bool
+}
+
+// ModuleLevels lists the effective level of every module, global first
+func ModuleLevels() []*ModuleLevel {
+	modulesLock.RLock()
+	defer modulesLock.RUnlock()
+	res := make([]*ModuleLevel, 0, len(modules))
+	for name, m := range modules {
+		res = append(res, &ModuleLevel{
+			Module:    name,
+			Level:     m.Level(),
+			Inherited: atomic.LoadInt32(&m.level) == INHERIT_LEVEL,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Module < res[j].Module
+	})
+	return append([]*ModuleLevel{{Module: "global", Level: Log.Level()}}, res...)
+}
+
+// LevelHandler lists the levels of all modules on GET and changes the level
+// of one on POST, e.g. POST /loglevel?module=sender&level=1. Level -1 makes
+// the module inherit the global level again.
+func LevelHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		level, err := strconv.Atoi(r.FormValue("level"))
+		if err != nil {
+			http.Error(w, "invalid level: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		module := r.FormValue("module")
+		if err := SetModuleLevel(module, level); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		Infof("LevelHandler - log level of %s set to %d", module, level)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ModuleLevels())
+}
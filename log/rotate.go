@@ -0,0 +1,241 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LOG_FILE_SUFFIX = "_LOG.log"
+	GZIP_SUFFIX     = ".gz"
+
+	ROTATE_RETRY_INTERVAL = time.Minute
+)
+
+// RotateConfig controls when RotateFile starts a new file
+type RotateConfig struct {
+	MaxSize    int64         // MB, 0 means DEFAULT_MAX_LOG_SIZE
+	MaxAge     time.Duration // a file is rotated after being written for MaxAge, 0 disables
+	MaxBackups int           // rotated files kept at most, 0 keeps all
+	Compress   bool          // gzip rotated files
+}
+
+var rotateConfig = &RotateConfig{}
+
+// SetRotation changes the rotation of log files opened by later InitLog calls
+func SetRotation(cfg *RotateConfig) {
+	rotateConfig = cfg
+}
+
+// RotateFile writes to a file under dir and switches to a new one when the
+// current one exceeds MaxSize or MaxAge
+type RotateFile struct {
+	dir      string
+	cfg      *RotateConfig
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	retryAt  time.Time // no rotation before, set when the last one failed
+	lock     sync.Mutex
+}
+
+func NewRotateFile(dir string, cfg *RotateConfig) (*RotateFile, error) {
+	if fi, err := os.Stat(dir); err == nil {
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("open %s: not a directory", dir)
+		}
+	} else if os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0766); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+	this := &RotateFile{dir: dir, cfg: cfg}
+	if err := this.openNew(); err != nil {
+		return nil, err
+	}
+	return this, nil
+}
+
+// openFile switches to the file name, the current file is only closed once
+// name has been opened
+func (this *RotateFile) openFile(name string) error {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if this.file != nil {
+		this.file.Close()
+	}
+	this.file = file
+	this.size = fi.Size()
+	this.openedAt = time.Now()
+	return nil
+}
+
+func (this *RotateFile) newName() string {
+	return filepath.Join(this.dir, time.Now().Format("2006-01-02_15.04.05")+LOG_FILE_SUFFIX)
+}
+
+func (this *RotateFile) openNew() error {
+	return this.openFile(this.newName())
+}
+
+func (this *RotateFile) maxSize() int64 {
+	return GetMaxLogChangeInterval(this.cfg.MaxSize)
+}
+
+func (this *RotateFile) Write(p []byte) (int, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.file == nil {
+		return 0, os.ErrClosed
+	}
+	if (this.size+int64(len(p)) > this.maxSize() ||
+		(this.cfg.MaxAge > 0 && time.Since(this.openedAt) > this.cfg.MaxAge)) && time.Now().After(this.retryAt) {
+		if err := this.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "log: failed to rotate log file: %v\n", err)
+		}
+	}
+	n, err := this.file.Write(p)
+	this.size += int64(n)
+	return n, err
+}
+
+// rotate switches to a new file, the current one is kept when the new one
+// can't be opened. Rotated files are compressed and pruned in the background.
+func (this *RotateFile) rotate() error {
+	old := this.file.Name()
+	name := this.newName()
+	if name == old {
+		// rotated within the same second, keep appending
+		return nil
+	}
+	if err := this.openFile(name); err != nil {
+		this.retryAt = time.Now().Add(ROTATE_RETRY_INTERVAL)
+		return err
+	}
+	go this.cleanup(old, name)
+	return nil
+}
+
+func (this *RotateFile) cleanup(rotated, current string) {
+	if this.cfg.Compress {
+		if err := compressFile(rotated); err != nil {
+			fmt.Fprintf(os.Stderr, "log: failed to compress %s: %v\n", rotated, err)
+		}
+	}
+	if this.cfg.MaxBackups <= 0 {
+		return
+	}
+	infos, err := ioutil.ReadDir(this.dir)
+	if err != nil {
+		return
+	}
+	backups := make([]string, 0)
+	for _, fi := range infos {
+		name := fi.Name()
+		if name == filepath.Base(current) || !strings.HasSuffix(strings.TrimSuffix(name, GZIP_SUFFIX), LOG_FILE_SUFFIX) {
+			continue
+		}
+		backups = append(backups, name)
+	}
+	// names start with the time they were opened
+	sort.Strings(backups)
+	for len(backups) > this.cfg.MaxBackups {
+		os.Remove(filepath.Join(this.dir, backups[0]))
+		backups = backups[1:]
+	}
+}
+
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+GZIP_SUFFIX, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + GZIP_SUFFIX)
+		return err
+	}
+	return os.Remove(name)
+}
+
+// Reopen closes and reopens the current file by name, so a file moved away
+// by an external tool like logrotate is recreated
+func (this *RotateFile) Reopen() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.file == nil {
+		return os.ErrClosed
+	}
+	return this.openFile(this.file.Name())
+}
+
+func (this *RotateFile) Size() int64 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.size
+}
+
+func (this *RotateFile) Close() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.file == nil {
+		return nil
+	}
+	err := this.file.Close()
+	this.file = nil
+	return err
+}
+
+// Reopen reopens the log file of Log, e.g. on SIGHUP
+func Reopen() error {
+	if Log.rotator == nil {
+		return nil
+	}
+	return Log.rotator.Reopen()
+}
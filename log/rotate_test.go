@@ -0,0 +1,195 @@
+/*
+ * Copyright (C) 2018 The ontology Authors
+ * This file is part of The ontology library.
+ *
+ * The ontology is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The ontology is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The ontology.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func logFiles(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0)
+	for _, fi := range infos {
+		if !fi.IsDir() {
+			names = append(names, fi.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// waitFiles waits for the background cleanup of rotated files
+func waitFiles(t *testing.T, dir string, ok func(names []string) bool) []string {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		names := logFiles(t, dir)
+		if ok(names) {
+			return names
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected log files %v", names)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// nextSecond waits until rotated files get a new name
+func nextSecond() {
+	time.Sleep(time.Second + 100*time.Millisecond)
+}
+
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	rf, err := NewRotateFile(dir, &RotateConfig{MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	chunk := bytes.Repeat([]byte("a"), 600*1024)
+	if _, err = rf.Write(chunk); err != nil {
+		t.Fatal(err)
+	}
+	nextSecond()
+	if _, err = rf.Write(chunk); err != nil {
+		t.Fatal(err)
+	}
+	names := logFiles(t, dir)
+	if len(names) != 2 {
+		t.Fatalf("expected 2 log files, got %v", names)
+	}
+	fi, err := os.Stat(filepath.Join(dir, names[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != int64(len(chunk)) || rf.Size() != int64(len(chunk)) {
+		t.Fatalf("unexpected sizes, rotated %d, current %d", fi.Size(), rf.Size())
+	}
+}
+
+func TestRotateByAge(t *testing.T) {
+	dir := t.TempDir()
+	rf, err := NewRotateFile(dir, &RotateConfig{MaxAge: 500 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	rf.Write([]byte("first\n"))
+	rf.Write([]byte("still first\n"))
+	if names := logFiles(t, dir); len(names) != 1 {
+		t.Fatalf("rotated before MaxAge: %v", names)
+	}
+	nextSecond()
+	rf.Write([]byte("second\n"))
+	if names := logFiles(t, dir); len(names) != 2 {
+		t.Fatalf("expected 2 log files, got %v", names)
+	}
+}
+
+func TestRotateRetentionAndCompress(t *testing.T) {
+	dir := t.TempDir()
+	rf, err := NewRotateFile(dir, &RotateConfig{MaxAge: time.Millisecond, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	for i := 0; i < 4; i++ {
+		rf.Write([]byte("line\n"))
+		nextSecond()
+	}
+	rf.Write([]byte("last\n"))
+	names := waitFiles(t, dir, func(names []string) bool {
+		return len(names) == 3 && strings.HasSuffix(names[0], GZIP_SUFFIX) && strings.HasSuffix(names[1], GZIP_SUFFIX)
+	})
+	if strings.HasSuffix(names[2], GZIP_SUFFIX) {
+		t.Fatalf("current file compressed: %v", names)
+	}
+	f, err := os.Open(filepath.Join(dir, names[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "line\n" {
+		t.Fatalf("unexpected content of rotated file: %q", content)
+	}
+}
+
+func TestRotateKeepsFileOnOpenFailure(t *testing.T) {
+	dir := t.TempDir()
+	rf, err := NewRotateFile(dir, &RotateConfig{MaxAge: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	old := logFiles(t, dir)[0]
+
+	// directories in place of the next files make opening them fail
+	now := time.Now()
+	for i := 1; i <= 3; i++ {
+		name := now.Add(time.Duration(i)*time.Second).Format("2006-01-02_15.04.05") + LOG_FILE_SUFFIX
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nextSecond()
+	if _, err = rf.Write([]byte("kept\n")); err != nil {
+		t.Fatalf("write failed after a failed rotation: %v", err)
+	}
+	if rf.retryAt.IsZero() {
+		t.Fatal("failed rotation not delayed")
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "kept\n" {
+		t.Fatalf("unexpected content of the current file: %q", content)
+	}
+
+	// rotates again once the retry interval has passed
+	rf.retryAt = time.Time{}
+	time.Sleep(3 * time.Second)
+	if _, err = rf.Write([]byte("rotated\n")); err != nil {
+		t.Fatal(err)
+	}
+	if names := logFiles(t, dir); len(names) != 2 {
+		t.Fatalf("expected 2 log files, got %v", names)
+	}
+}
@@ -17,14 +17,16 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/polynetwork/heco_relayer/cmd"
 	"github.com/polynetwork/heco_relayer/config"
 	"github.com/polynetwork/heco_relayer/db"
+	"github.com/polynetwork/heco_relayer/health"
 	"github.com/polynetwork/heco_relayer/log"
 	"github.com/polynetwork/heco_relayer/manager"
-	sdk "github.com/polynetwork/poly-go-sdk"
+	"github.com/polynetwork/heco_relayer/notify"
+	"github.com/polynetwork/heco_relayer/tools"
 	"github.com/urfave/cli"
 	"net/http"
 	_ "net/http/pprof"
@@ -32,6 +34,7 @@ import (
 	"os/signal"
 	"runtime"
 	"syscall"
+	"time"
 )
 
 var ConfigPath string
@@ -48,13 +51,20 @@ func setupApp() *cli.App {
 	app.Copyright = "Copyright in 2020 The poly network Authors"
 	app.Flags = []cli.Flag{
 		cmd.LogLevelFlag,
+		cmd.LogFormatFlag,
 		cmd.ConfigPathFlag,
 		cmd.HecoStartFlag,
 		cmd.HecoStartForceFlag,
 		cmd.PolyStartFlag,
 		cmd.LogDir,
+		cmd.LogMaxSizeFlag,
+		cmd.LogMaxAgeFlag,
+		cmd.LogBackupsFlag,
+		cmd.LogCompressFlag,
+	}
+	app.Commands = []cli.Command{
+		cmd.TransferCommand,
 	}
-	app.Commands = []cli.Command{}
 	app.Before = func(context *cli.Context) error {
 		runtime.GOMAXPROCS(runtime.NumCPU())
 		return nil
@@ -66,6 +76,18 @@ func startServer(ctx *cli.Context) {
 	// get all cmd flag
 	logLevel := ctx.GlobalInt(cmd.GetFlagName(cmd.LogLevelFlag))
 
+	logFormat, err := log.ParseFormat(ctx.GlobalString(cmd.GetFlagName(cmd.LogFormatFlag)))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	log.SetFormat(logFormat)
+	log.SetRotation(&log.RotateConfig{
+		MaxSize:    ctx.GlobalInt64(cmd.GetFlagName(cmd.LogMaxSizeFlag)),
+		MaxAge:     time.Duration(ctx.GlobalUint64(cmd.GetFlagName(cmd.LogMaxAgeFlag))) * time.Hour,
+		MaxBackups: ctx.GlobalInt(cmd.GetFlagName(cmd.LogBackupsFlag)),
+		Compress:   ctx.GlobalBool(cmd.GetFlagName(cmd.LogCompressFlag)),
+	})
 	ld := ctx.GlobalString(cmd.GetFlagName(cmd.LogDir))
 	log.InitLog(logLevel, ld, log.Stdout)
 
@@ -91,17 +113,27 @@ func startServer(ctx *cli.Context) {
 		log.Errorf("startServer - create config failed!")
 		return
 	}
+	for module, level := range servConfig.LogLevels {
+		if err := log.SetModuleLevel(module, level); err != nil {
+			log.Errorf("startServer - failed to set log level of %s: %v", module, err)
+			return
+		}
+	}
+
+	if err := notify.Setup(servConfig.NotifyConfig); err != nil {
+		log.Errorf("startServer - failed to setup notifications: %v", err)
+		return
+	}
 
 	// create poly sdk
-	polySdk := sdk.NewPolySdk()
-	err := setUpPoly(polySdk, servConfig.PolyConfig.RestURL)
+	polySdk, err := tools.NewPolyClient(servConfig.PolyConfig)
 	if err != nil {
 		log.Errorf("startServer - failed to setup poly sdk: %v", err)
 		return
 	}
 
 	// create heco sdk
-	ethereumsdk, err := ethclient.Dial(servConfig.HecoConfig.RestURL)
+	ethereumsdk, err := tools.NewHecoClient(servConfig.HecoConfig)
 	if err != nil {
 		log.Errorf("startServer - cannot dial sync node, err: %s", err)
 		return
@@ -118,23 +150,50 @@ func startServer(ctx *cli.Context) {
 		return
 	}
 
+	manager.RegisterHeartbeats(servConfig.GetHeartbeatTimeout())
+	health.AddLiveness("db", boltDB.Check)
+	health.AddReadiness("heco_rpc", ethereumsdk.CheckHealth)
+	health.AddReadiness("poly_rpc", polySdk.CheckHealth)
+
 	initPolyServer(servConfig, polySdk, ethereumsdk, boltDB)
 	initHecoServer(servConfig, polySdk, ethereumsdk, boltDB)
 
+	chainsHandler := func(w http.ResponseWriter, r *http.Request) {
+		status := []*tools.ChainStatus{ethereumsdk.Status(), polySdk.Status()}
+		if status[0].Degraded || status[1].Degraded {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	}
+	http.HandleFunc("/chains", chainsHandler)
+	http.HandleFunc("/loglevel", log.LevelHandler)
+	http.HandleFunc("/transfers", func(w http.ResponseWriter, r *http.Request) {
+		transfers, err := boltDB.FindTransfers(r.FormValue("hash"), r.FormValue("cid"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(transfers) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		json.NewEncoder(w).Encode(transfers)
+	})
+	health.Default.HandleFuncs(http.DefaultServeMux)
 	go func() {
 		http.ListenAndServe("localhost:6060", nil)
 	}()
-	waitToExit()
-}
-
-func setUpPoly(poly *sdk.PolySdk, RpcAddr string) error {
-	poly.NewRpcClient().SetAddress(RpcAddr)
-	hdr, err := poly.GetHeaderByHeight(0)
-	if err != nil {
-		return err
+	if servConfig.HealthAddr != "" {
+		// probes of orchestrators can't reach localhost, serve them without pprof
+		mux := http.NewServeMux()
+		mux.HandleFunc("/chains", chainsHandler)
+		health.Default.HandleFuncs(mux)
+		go func() {
+			if err := http.ListenAndServe(servConfig.HealthAddr, mux); err != nil {
+				log.Errorf("startServer - failed to serve health check on %s: %v", servConfig.HealthAddr, err)
+			}
+		}()
 	}
-	poly.SetChainId(hdr.ChainID)
-	return nil
+	waitToExit()
 }
 
 func waitToExit() {
@@ -143,6 +202,13 @@ func waitToExit() {
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	go func() {
 		for sig := range sc {
+			if sig == syscall.SIGHUP {
+				log.Infof("waitToExit - Heco relayer received SIGHUP, reopen log file")
+				if err := log.Reopen(); err != nil {
+					fmt.Printf("failed to reopen log file: %v\n", err)
+				}
+				continue
+			}
 			log.Infof("waitToExit - Heco relayer received exit signal:%v.", sig.String())
 			close(exit)
 			break
@@ -151,10 +217,10 @@ func waitToExit() {
 	<-exit
 }
 
-func initHecoServer(servConfig *config.ServiceConfig, polysdk *sdk.PolySdk, ethereumsdk *ethclient.Client, boltDB *db.BoltDB) {
+func initHecoServer(servConfig *config.ServiceConfig, polysdk *tools.PolyClient, ethereumsdk *tools.HecoClient, boltDB *db.BoltDB) {
 	mgr, err := manager.NewHecoManager(servConfig, StartHeight, StartForceHeight, polysdk, ethereumsdk, boltDB)
 	if err != nil {
-		log.Error("initHecoServer - HecoServer start err: %s", err.Error())
+		log.Errorf("initHecoServer - HecoServer start err: %s", err.Error())
 		return
 	}
 	go mgr.MonitorHecoChain()
@@ -162,14 +228,16 @@ func initHecoServer(servConfig *config.ServiceConfig, polysdk *sdk.PolySdk, ethe
 	go mgr.CheckDeposit()
 }
 
-func initPolyServer(servConfig *config.ServiceConfig, polysdk *sdk.PolySdk, ethereumsdk *ethclient.Client, boltDB *db.BoltDB) {
+func initPolyServer(servConfig *config.ServiceConfig, polysdk *tools.PolyClient, ethereumsdk *tools.HecoClient, boltDB *db.BoltDB) {
 	mgr, err := manager.NewPolyManager(servConfig, uint32(PolyStartHeight), polysdk, ethereumsdk, boltDB)
 	if err != nil {
-		log.Error("initPolyServer - PolyServer service start failed: %v", err)
+		log.Errorf("initPolyServer - PolyServer service start failed: %v", err)
 		return
 	}
+	go mgr.MonitorEpoch()
 	go mgr.MonitorPolyChain()
 	go mgr.MonitorDeposit()
+	go mgr.MonitorBalance()
 }
 
 func main() {
@@ -0,0 +1,128 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package manager
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/polynetwork/heco_relayer/config"
+	"github.com/polynetwork/heco_relayer/notify"
+)
+
+var (
+	senderBalances = expvar.NewMap("heco_sender_balances") // wei
+	senderExcluded = expvar.NewMap("heco_sender_excluded") // 1 when excluded for low balance
+)
+
+// minSenderBalance returns the balance a sender needs to be selected: the
+// configured MinSenderBalance, or the cost of a relay at max gas limit
+func (this *PolyManager) minSenderBalance() (*big.Int, error) {
+	if this.config.HecoConfig.MinSenderBalance != "" {
+		ht, ok := new(big.Float).SetString(this.config.HecoConfig.MinSenderBalance)
+		if !ok {
+			return nil, fmt.Errorf("invalid MinSenderBalance %s", this.config.HecoConfig.MinSenderBalance)
+		}
+		wei, _ := new(big.Float).Mul(ht, big.NewFloat(1e18)).Int(nil)
+		return wei, nil
+	}
+	gasPrice, err := this.ethClient.SuggestGasPrice(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(MAX_GAS_LIMIT)), nil
+}
+
+// refreshBalances reads the balance of every sender and excludes the ones
+// below the threshold from selection until they are topped up
+func (this *PolyManager) refreshBalances() {
+	min, err := this.minSenderBalance()
+	if err != nil {
+		senderLog.Errorf("refreshBalances - failed to get min sender balance: %v", err)
+		return
+	}
+	for _, v := range this.senders {
+		bal, err := v.Balance()
+		if err != nil {
+			senderLog.Errorf("refreshBalances - failed to get balance for %s: %v", v.acc.Address.String(), err)
+			continue
+		}
+		low := bal.Cmp(min) < 0
+		v.lock.Lock()
+		wasLow := v.lowBalance
+		v.balance = bal
+		v.lowBalance = low
+		v.lock.Unlock()
+
+		addr := v.acc.Address.String()
+		senderBalances.Set(addr, newBigVar(bal))
+		if low {
+			senderExcluded.Set(addr, newIntVar(1))
+		} else {
+			senderExcluded.Set(addr, newIntVar(0))
+		}
+		if low && !wasLow {
+			senderLog.Errorf("refreshBalances - balance of sender %s is %s wei, lower than %s wei, exclude it from relaying",
+				addr, bal.String(), min.String())
+			notify.Notify(&notify.Event{
+				Kind:    notify.EVENT_LOW_BALANCE,
+				Subject: addr,
+				Message: fmt.Sprintf("heco sender %s is excluded from relaying, balance %s wei is lower than %s wei", addr, bal.String(), min.String()),
+				Fields:  map[string]string{"balance": bal.String(), "min_balance": min.String()},
+			})
+		} else if !low && wasLow {
+			senderLog.Infof("refreshBalances - sender %s topped up to %s wei, include it again", addr, bal.String())
+		}
+	}
+}
+
+func (this *PolyManager) MonitorBalance() {
+	ticker := time.NewTicker(config.BALANCE_CHECK_INTERVAL)
+	for {
+		select {
+		case <-ticker.C:
+			this.refreshBalances()
+		case <-this.exitChan:
+			return
+		}
+	}
+}
+
+// checkSenders fails when no sender has enough balance to relay
+func (this *PolyManager) checkSenders() error {
+	for _, v := range this.senders {
+		if _, ok := v.cachedBalance(); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("no heco sender has enough balance")
+}
+
+func newBigVar(v *big.Int) *expvar.String {
+	s := new(expvar.String)
+	s.Set(v.String())
+	return s
+}
+
+func newIntVar(v int64) *expvar.Int {
+	i := new(expvar.Int)
+	i.Set(v)
+	return i
+}
@@ -0,0 +1,211 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/polynetwork/eth-contracts/go_abi/eccd_abi"
+	"github.com/polynetwork/heco_relayer/config"
+	"github.com/polynetwork/heco_relayer/health"
+	vconfig "github.com/polynetwork/poly/consensus/vbft/config"
+	polytypes "github.com/polynetwork/poly/core/types"
+)
+
+const (
+	EPOCH_UNKNOWN = -1 // not checked yet
+	EPOCH_SYNCED  = 0  // heco knows the bookkeepers of the current poly epoch
+)
+
+// epochCache keeps the epoch state of the ECCD on heco, which only changes
+// with changeBookKeeper, so scanning poly doesn't cost heco calls per block
+type epochCache struct {
+	eccd       *eccd_abi.EthCrossChainData
+	height     uint32 // start height of the current epoch
+	bookKeeper []byte // raw bookkeepers of the current epoch
+	valid      bool
+	lock       sync.Mutex
+}
+
+func newEpochCache(eccd *eccd_abi.EthCrossChainData) *epochCache {
+	return &epochCache{eccd: eccd}
+}
+
+// get returns the current epoch of ECCD, loading it when invalidated
+func (this *epochCache) get() (uint32, []byte, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.valid {
+		return this.height, this.bookKeeper, nil
+	}
+	height, err := this.eccd.GetCurEpochStartHeight(nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get current epoch start height: %v", err)
+	}
+	bookKeeper, err := this.eccd.GetCurEpochConPubKeyBytes(nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get current epoch keepers: %v", err)
+	}
+	if this.height != 0 && this.height != height {
+		headerSyncLog.Infof("epochCache - epoch on heco changed from %d to %d", this.height, height)
+	}
+	this.height, this.bookKeeper, this.valid = height, bookKeeper, true
+	return height, bookKeeper, nil
+}
+
+// invalidate makes the next get read ECCD again
+func (this *epochCache) invalidate() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.valid = false
+}
+
+// pendingEpoch is the height of the first poly epoch whose bookkeepers are
+// not on heco yet, or one of EPOCH_UNKNOWN and EPOCH_SYNCED. Poly blocks from
+// that height on are signed by bookkeepers heco doesn't know, so their txs
+// are not scanned until the epoch is changed on heco.
+func (this *PolyManager) pendingEpoch() int64 {
+	return atomic.LoadInt64(&this.epoch)
+}
+
+// lastConfigHeight returns the height of the poly block that started the epoch hdr is in
+func lastConfigHeight(hdr *polytypes.Header) (uint32, error) {
+	blkInfo := &vconfig.VbftBlockInfo{}
+	if err := json.Unmarshal(hdr.ConsensusPayload, blkInfo); err != nil {
+		return 0, fmt.Errorf("unmarshal blockInfo of %d error: %s", hdr.Height, err)
+	}
+	return blkInfo.LastConfigBlockNum, nil
+}
+
+// newEpochs lists the headers starting poly epochs after the epoch on heco
+// that change the bookkeepers, the oldest first. The cached epoch of heco is
+// read again as soon as poly has a newer one, it may have been changed by
+// another relayer.
+func (this *PolyManager) newEpochs() ([]*polytypes.Header, [][]byte, error) {
+	headers, pubkLists, err := this.findNewEpochs()
+	if err != nil || len(headers) == 0 {
+		return headers, pubkLists, err
+	}
+	this.epochCache.invalidate()
+	return this.findNewEpochs()
+}
+
+func (this *PolyManager) findNewEpochs() ([]*polytypes.Header, [][]byte, error) {
+	eccdHeight, _, err := this.epochCache.get()
+	if err != nil {
+		return nil, nil, err
+	}
+	height, err := this.polySdk.GetCurrentBlockHeight()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get poly height: %v", err)
+	}
+	// every block refers to the block that started its epoch, the block
+	// before an epoch start refers to the previous epoch
+	var starts []*polytypes.Header
+	for height > 0 {
+		hdr, err := this.polySdk.GetHeaderByHeight(height)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get poly header %d: %v", height, err)
+		}
+		start, err := lastConfigHeight(hdr)
+		if err != nil {
+			return nil, nil, err
+		}
+		if start == math.MaxUint32 || start <= eccdHeight {
+			break
+		}
+		if start != hdr.Height {
+			if hdr, err = this.polySdk.GetHeaderByHeight(start); err != nil {
+				return nil, nil, fmt.Errorf("failed to get poly header %d: %v", start, err)
+			}
+		}
+		starts = append([]*polytypes.Header{hdr}, starts...)
+		height = start - 1
+	}
+	headers := make([]*polytypes.Header, 0, len(starts))
+	pubkLists := make([][]byte, 0, len(starts))
+	for _, hdr := range starts {
+		isEpoch, pubkList, err := this.IsEpoch(hdr)
+		if err != nil {
+			return nil, nil, err
+		}
+		if isEpoch {
+			headers = append(headers, hdr)
+			pubkLists = append(pubkLists, pubkList)
+		}
+	}
+	return headers, pubkLists, nil
+}
+
+// syncEpoch changes the bookkeepers on heco to the next poly epoch if
+// EnableChangeBookKeeper is set, and updates the pending epoch. It returns
+// true when another epoch may follow right away.
+func (this *PolyManager) syncEpoch() bool {
+	headers, pubkLists, err := this.newEpochs()
+	if err != nil {
+		headerSyncLog.Errorf("syncEpoch - %v", err)
+		return false
+	}
+	if len(headers) == 0 {
+		if atomic.SwapInt64(&this.epoch, EPOCH_SYNCED) > EPOCH_SYNCED {
+			headerSyncLog.Infof("syncEpoch - heco is on the current poly epoch, resume scanning poly")
+		}
+		return false
+	}
+	hdr := headers[0]
+	if atomic.SwapInt64(&this.epoch, int64(hdr.Height)) != int64(hdr.Height) {
+		headerSyncLog.Warnf("syncEpoch - poly epoch %d is not on heco yet (%d epochs behind), poly scanning stops before it", hdr.Height, len(headers))
+	}
+	if !this.config.HecoConfig.EnableChangeBookKeeper {
+		return false
+	}
+	sender := this.selectSender(nil)
+	if sender == nil {
+		headerSyncLog.Errorf("syncEpoch - no sender available to change bookkeepers to poly epoch %d", hdr.Height)
+		return false
+	}
+	if !sender.commitHeader(hdr, pubkLists[0]) {
+		return false
+	}
+	this.epochCache.invalidate()
+	return true
+}
+
+// MonitorEpoch keeps the bookkeepers on heco in step with poly, independent
+// of the poly scanner which waits for it at epoch changes
+func (this *PolyManager) MonitorEpoch() {
+	ticker := time.NewTicker(config.EPOCH_CHECK_INTERVAL)
+	defer ticker.Stop()
+	for {
+		health.Beat(HEARTBEAT_MONITOR_POLY_EPOCH)
+		if !chainsDegraded("MonitorEpoch", this.ethClient, this.polySdk) {
+			for this.syncEpoch() {
+				health.Beat(HEARTBEAT_MONITOR_POLY_EPOCH)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-this.exitChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,195 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package manager
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/polynetwork/heco_relayer/config"
+	poly_bridge_sdk "github.com/polynetwork/poly-bridge/bridgesdk"
+)
+
+const (
+	FEE_MODE_BRIDGE    = "bridge"
+	FEE_MODE_ALLOWLIST = "allowlist"
+	FEE_MODE_ALL       = "all"
+)
+
+type FeeCheckReq struct {
+	poly_bridge_sdk.CheckFeeReq
+	FromContract string // hex of the contract that started the tx on the source chain
+}
+
+// FeeCheckRsp is the fee state of a tx, Unchecked is set when the tx is
+// treated as paid by policy without its fee being looked at
+type FeeCheckRsp struct {
+	*poly_bridge_sdk.CheckFeeRsp
+	Unchecked bool
+}
+
+// FeeChecker tells if the fee of cross chain txs has been paid
+type FeeChecker interface {
+	CheckFee(checks []*FeeCheckReq) ([]*FeeCheckRsp, error)
+}
+
+func NewFeeChecker(cfg *config.ServiceConfig) (FeeChecker, error) {
+	switch cfg.FeeMode {
+	case "", FEE_MODE_BRIDGE:
+		return NewBridgeFeeChecker(cfg.GetBridgeURLs())
+	case FEE_MODE_ALLOWLIST:
+		var next FeeChecker
+		if urls := cfg.GetBridgeURLs(); len(urls) > 0 {
+			next, _ = NewBridgeFeeChecker(urls)
+		}
+		return NewAllowListFeeChecker(cfg.FeeAllowList, next), nil
+	case FEE_MODE_ALL:
+		return &RelayAllFeeChecker{}, nil
+	default:
+		return nil, fmt.Errorf("unknown fee mode %s", cfg.FeeMode)
+	}
+}
+
+// BridgeFeeChecker asks the poly bridge, it sticks to one url and fails over
+// to the next one when a call fails
+type BridgeFeeChecker struct {
+	urls    []string
+	sdks    []*poly_bridge_sdk.BridgeSdk
+	current int
+	lock    sync.Mutex
+}
+
+func NewBridgeFeeChecker(urls []string) (*BridgeFeeChecker, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("NewBridgeFeeChecker - no bridge url configured")
+	}
+	this := &BridgeFeeChecker{urls: urls}
+	for _, url := range urls {
+		this.sdks = append(this.sdks, poly_bridge_sdk.NewBridgeSdk(url))
+	}
+	return this, nil
+}
+
+func (this *BridgeFeeChecker) CheckFee(checks []*FeeCheckReq) ([]*FeeCheckRsp, error) {
+	reqs := make([]*poly_bridge_sdk.CheckFeeReq, len(checks))
+	for i, v := range checks {
+		reqs[i] = &v.CheckFeeReq
+	}
+	this.lock.Lock()
+	start := this.current
+	this.lock.Unlock()
+
+	var err error
+	for i := 0; i < len(this.sdks); i++ {
+		idx := (start + i) % len(this.sdks)
+		var rsp []*poly_bridge_sdk.CheckFeeRsp
+		rsp, err = this.sdks[idx].CheckFee(reqs)
+		if err == nil {
+			if idx != start {
+				feeLog.Warnf("BridgeFeeChecker - switch bridge url from %s to %s", this.urls[start], this.urls[idx])
+				this.lock.Lock()
+				this.current = idx
+				this.lock.Unlock()
+			}
+			res := make([]*FeeCheckRsp, len(rsp))
+			for i, v := range rsp {
+				res[i] = &FeeCheckRsp{CheckFeeRsp: v}
+			}
+			return res, nil
+		}
+		feeLog.Warnf("BridgeFeeChecker - check fee on %s failed: %v", this.urls[idx], err)
+	}
+	return nil, fmt.Errorf("all bridge urls failed, last error: %v", err)
+}
+
+// AllowListFeeChecker relays txs from the listed (source chain, contract)
+// pairs without asking anyone, the other txs go to next. Without next they
+// are treated as not paid.
+type AllowListFeeChecker struct {
+	allowed map[uint64]map[string]bool
+	next    FeeChecker
+}
+
+func NewAllowListFeeChecker(list []*config.FeeAllowItem, next FeeChecker) *AllowListFeeChecker {
+	this := &AllowListFeeChecker{
+		allowed: make(map[uint64]map[string]bool),
+		next:    next,
+	}
+	for _, v := range list {
+		if this.allowed[v.ChainId] == nil {
+			this.allowed[v.ChainId] = make(map[string]bool)
+		}
+		this.allowed[v.ChainId][normalizeContract(v.Contract)] = true
+	}
+	return this
+}
+
+func normalizeContract(contract string) string {
+	return strings.TrimPrefix(strings.ToLower(contract), "0x")
+}
+
+func (this *AllowListFeeChecker) CheckFee(checks []*FeeCheckReq) ([]*FeeCheckRsp, error) {
+	res := make([]*FeeCheckRsp, 0, len(checks))
+	rest := make([]*FeeCheckReq, 0)
+	for _, v := range checks {
+		if this.allowed[v.ChainId][normalizeContract(v.FromContract)] {
+			res = append(res, paidFeeRsp(v))
+			continue
+		}
+		if this.next == nil {
+			res = append(res, &FeeCheckRsp{CheckFeeRsp: &poly_bridge_sdk.CheckFeeRsp{
+				ChainId:  v.ChainId,
+				Hash:     v.Hash,
+				PayState: poly_bridge_sdk.STATE_NOTPAY,
+			}})
+			continue
+		}
+		rest = append(rest, v)
+	}
+	if len(rest) == 0 {
+		return res, nil
+	}
+	rsp, err := this.next.CheckFee(rest)
+	if err != nil {
+		return res, err
+	}
+	return append(res, rsp...), nil
+}
+
+// RelayAllFeeChecker treats every tx as paid, for private deployments
+type RelayAllFeeChecker struct{}
+
+func (this *RelayAllFeeChecker) CheckFee(checks []*FeeCheckReq) ([]*FeeCheckRsp, error) {
+	res := make([]*FeeCheckRsp, len(checks))
+	for i, v := range checks {
+		res[i] = paidFeeRsp(v)
+	}
+	return res, nil
+}
+
+func paidFeeRsp(check *FeeCheckReq) *FeeCheckRsp {
+	return &FeeCheckRsp{
+		CheckFeeRsp: &poly_bridge_sdk.CheckFeeRsp{
+			ChainId:  check.ChainId,
+			Hash:     check.Hash,
+			PayState: poly_bridge_sdk.STATE_HASPAY,
+			Amount:   "0",
+		},
+		Unchecked: true,
+	}
+}
@@ -0,0 +1,176 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/polynetwork/heco_relayer/config"
+	poly_bridge_sdk "github.com/polynetwork/poly-bridge/bridgesdk"
+)
+
+// feeStub is an http.Handler answering checkfee requests like the poly
+// bridge does, so BridgeFeeChecker can be run against an httptest server.
+// Txs without a state set are reported as not paid.
+type feeStub struct {
+	states map[string]*poly_bridge_sdk.CheckFeeRsp
+	lock   sync.Mutex
+}
+
+func newFeeStub() *feeStub {
+	return &feeStub{states: make(map[string]*poly_bridge_sdk.CheckFeeRsp)}
+}
+
+func (this *feeStub) Set(hash string, payState int, amount string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.states[hash] = &poly_bridge_sdk.CheckFeeRsp{Hash: hash, PayState: payState, Amount: amount}
+}
+
+func (this *feeStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "checkfee") {
+		http.NotFound(w, r)
+		return
+	}
+	req := new(poly_bridge_sdk.CheckFeesReq)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	this.lock.Lock()
+	rsp := &poly_bridge_sdk.CheckFeesRsp{CheckFees: make([]*poly_bridge_sdk.CheckFeeRsp, 0, len(req.Checks))}
+	for _, v := range req.Checks {
+		item := &poly_bridge_sdk.CheckFeeRsp{ChainId: v.ChainId, Hash: v.Hash, PayState: poly_bridge_sdk.STATE_NOTPAY}
+		if state, ok := this.states[v.Hash]; ok {
+			item.PayState = state.PayState
+			item.Amount = state.Amount
+		}
+		rsp.CheckFees = append(rsp.CheckFees, item)
+	}
+	this.lock.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rsp)
+}
+
+func feeCheck(chainId uint64, hash string, fromContract string) *FeeCheckReq {
+	return &FeeCheckReq{
+		CheckFeeReq:  poly_bridge_sdk.CheckFeeReq{ChainId: chainId, Hash: hash},
+		FromContract: fromContract,
+	}
+}
+
+func feeStates(rsp []*FeeCheckRsp) map[string]*FeeCheckRsp {
+	res := make(map[string]*FeeCheckRsp)
+	for _, v := range rsp {
+		res[v.Hash] = v
+	}
+	return res
+}
+
+func TestBridgeFeeCheckerFailover(t *testing.T) {
+	stub := newFeeStub()
+	stub.Set("aa", poly_bridge_sdk.STATE_HASPAY, "1.5")
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	dead := httptest.NewServer(stub)
+	dead.Close()
+
+	checker, err := NewBridgeFeeChecker([]string{dead.URL + "/", server.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		rsp, err := checker.CheckFee([]*FeeCheckReq{feeCheck(2, "aa", ""), feeCheck(2, "bb", "")})
+		if err != nil {
+			t.Fatalf("round %d: %v", i, err)
+		}
+		states := feeStates(rsp)
+		if v := states["aa"]; v == nil || v.PayState != poly_bridge_sdk.STATE_HASPAY || v.Amount != "1.5" || v.Unchecked {
+			t.Fatalf("round %d: unexpected state of aa: %+v", i, v)
+		}
+		if v := states["bb"]; v == nil || v.PayState != poly_bridge_sdk.STATE_NOTPAY {
+			t.Fatalf("round %d: unexpected state of bb: %+v", i, v)
+		}
+	}
+	if checker.current != 1 {
+		t.Fatalf("expected to stick to the live url, current is %d", checker.current)
+	}
+}
+
+func TestBridgeFeeCheckerAllFailed(t *testing.T) {
+	dead := httptest.NewServer(newFeeStub())
+	dead.Close()
+	checker, _ := NewBridgeFeeChecker([]string{dead.URL + "/", dead.URL + "/"})
+	if _, err := checker.CheckFee([]*FeeCheckReq{feeCheck(2, "aa", "")}); err == nil {
+		t.Fatal("expected an error when no bridge url is available")
+	}
+}
+
+func TestAllowListFeeChecker(t *testing.T) {
+	list := []*config.FeeAllowItem{{ChainId: 2, Contract: "0xAbCd"}}
+
+	stub := newFeeStub()
+	stub.Set("paid", poly_bridge_sdk.STATE_HASPAY, "2")
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	next, _ := NewBridgeFeeChecker([]string{server.URL + "/"})
+
+	for _, checker := range []*AllowListFeeChecker{NewAllowListFeeChecker(list, next), NewAllowListFeeChecker(list, nil)} {
+		rsp, err := checker.CheckFee([]*FeeCheckReq{
+			feeCheck(2, "allowed", "abcd"),
+			feeCheck(3, "other_chain", "abcd"),
+			feeCheck(2, "paid", "1234"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		states := feeStates(rsp)
+		if v := states["allowed"]; v == nil || v.PayState != poly_bridge_sdk.STATE_HASPAY || !v.Unchecked {
+			t.Fatalf("allow-listed tx not relayed without check: %+v", v)
+		}
+		if v := states["other_chain"]; v == nil || v.PayState != poly_bridge_sdk.STATE_NOTPAY {
+			t.Fatalf("contract allowed on another chain treated as paid: %+v", v)
+		}
+		want := poly_bridge_sdk.STATE_NOTPAY
+		if checker.next != nil {
+			want = poly_bridge_sdk.STATE_HASPAY
+		}
+		if v := states["paid"]; v == nil || v.PayState != want || v.Unchecked {
+			t.Fatalf("unexpected state of tx not allow-listed: %+v", v)
+		}
+	}
+}
+
+func TestRelayAllFeeChecker(t *testing.T) {
+	rsp, err := (&RelayAllFeeChecker{}).CheckFee([]*FeeCheckReq{feeCheck(2, "aa", ""), feeCheck(3, "bb", "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(rsp))
+	}
+	for _, v := range rsp {
+		if v.PayState != poly_bridge_sdk.STATE_HASPAY || !v.Unchecked {
+			t.Fatalf("tx %s not relayed without check: %+v", v.Hash, v)
+		}
+	}
+}
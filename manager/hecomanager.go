@@ -20,24 +20,29 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	ethcommon "github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ontio/ontology/smartcontract/service/native/cross_chain/cross_chain_manager"
 	"github.com/polynetwork/eth-contracts/go_abi/eccm_abi"
 	"github.com/polynetwork/heco_relayer/config"
 	"github.com/polynetwork/heco_relayer/db"
+	"github.com/polynetwork/heco_relayer/health"
 	common2 "github.com/polynetwork/poly/native/service/cross_chain_manager/common"
 
 	"context"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/polynetwork/heco_relayer/log"
+	"github.com/polynetwork/heco_relayer/notify"
 	"github.com/polynetwork/heco_relayer/tools"
 	sdk "github.com/polynetwork/poly-go-sdk"
 	"github.com/polynetwork/poly/common"
@@ -102,15 +107,25 @@ func (this *CrossTransfer) Deserialization(source *common.ZeroCopySource) error
 	return nil
 }
 
+type proofTask struct {
+	refHeight uint64
+	retry     []byte
+}
+
 type HecoManager struct {
 	config         *config.ServiceConfig
-	restClient     *tools.RestClient
-	client         *ethclient.Client
-	currentHeight  uint64
+	client         *tools.HecoClient
+	currentHeight  uint64 // only written by the scanner, read atomically elsewhere
 	forceHeight    uint64
 	lockerContract *bind.BoundContract
-	polySdk        *sdk.PolySdk
+	polySdk        *tools.PolyClient
 	polySigner     *sdk.Account
+	proofSigners   []*sdk.Account
+	proofSignerIdx uint64
+	proofTasks     chan *proofTask
+	proofInflight  map[string]bool
+	proofLock      sync.Mutex
+	proofCache     *tools.ProofCache
 	exitChan       chan int
 	header4sync    [][]byte
 	crosstx4sync   []*CrossTransfer
@@ -118,7 +133,7 @@ type HecoManager struct {
 	skippedSenders map[ethcommon.Address]bool
 }
 
-func NewHecoManager(servconfig *config.ServiceConfig, startheight uint64, startforceheight uint64, ontsdk *sdk.PolySdk, client *ethclient.Client, boltDB *db.BoltDB) (*HecoManager, error) {
+func NewHecoManager(servconfig *config.ServiceConfig, startheight uint64, startforceheight uint64, ontsdk *tools.PolyClient, client *tools.HecoClient, boltDB *db.BoltDB) (*HecoManager, error) {
 	var wallet *sdk.Wallet
 	var err error
 	if !common.FileExisted(servconfig.PolyConfig.WalletFile) {
@@ -148,6 +163,11 @@ func NewHecoManager(servconfig *config.ServiceConfig, startheight uint64, startf
 	}
 	log.Infof("NewHecoManager - poly address: %s", signer.Address.ToBase58())
 
+	proofSigners, err := loadProofSigners(ontsdk, wallet, servconfig.PolyConfig, signer)
+	if err != nil {
+		return nil, err
+	}
+
 	skippedSenders := map[ethcommon.Address]bool{}
 	if servconfig.HecoConfig != nil {
 		for _, s := range servconfig.HecoConfig.SkippedSenders {
@@ -162,10 +182,12 @@ func NewHecoManager(servconfig *config.ServiceConfig, startheight uint64, startf
 		exitChan:       make(chan int),
 		currentHeight:  startheight,
 		forceHeight:    startforceheight,
-		restClient:     tools.NewRestClient(),
 		client:         client,
 		polySdk:        ontsdk,
 		polySigner:     signer,
+		proofSigners:   proofSigners,
+		proofInflight:  make(map[string]bool),
+		proofCache:     tools.NewProofCache(),
 		header4sync:    make([][]byte, 0),
 		crosstx4sync:   make([]*CrossTransfer, 0),
 		db:             boltDB,
@@ -174,9 +196,69 @@ func NewHecoManager(servconfig *config.ServiceConfig, startheight uint64, startf
 	err = mgr.init()
 	if err != nil {
 		return nil, err
-	} else {
-		return mgr, nil
 	}
+	health.AddReadiness("heco_cursor", mgr.checkCursorLag)
+	return mgr, nil
+}
+
+// checkCursorLag fails when the heco scanner falls too far behind the heco head
+func (this *HecoManager) checkCursorLag() error {
+	maxLag := this.config.HecoConfig.MaxCursorLag
+	if maxLag == 0 {
+		maxLag = config.DEFAULT_HECO_MAX_CURSOR_LAG
+	}
+	head := this.client.Status().Height
+	if cursor := atomic.LoadUint64(&this.currentHeight); head > cursor+this.config.HecoConfig.BlockConfig+maxLag {
+		return fmt.Errorf("heco scanner at %d is %d blocks behind head %d", cursor, head-cursor, head)
+	}
+	return nil
+}
+
+// loadProofSigners collects the accounts used to commit proofs to poly: every
+// non-default account of the main wallet plus all accounts of ProofWallets.
+// The default account is kept for header sync only, unless it is the only one.
+func loadProofSigners(ontsdk *tools.PolyClient, wallet *sdk.Wallet, polyConfig *config.PolyConfig, headerSigner *sdk.Account) ([]*sdk.Account, error) {
+	signers := make([]*sdk.Account, 0)
+	for i := 1; i <= wallet.GetAccountCount(); i++ {
+		acc, err := wallet.GetAccountByIndex(i, []byte(polyConfig.WalletPwd))
+		if err != nil {
+			proofLog.Warnf("loadProofSigners - failed to unlock account %d of %s: %v", i, polyConfig.WalletFile, err)
+			continue
+		}
+		if acc.Address == headerSigner.Address {
+			continue
+		}
+		signers = append(signers, acc)
+	}
+	for _, w := range polyConfig.ProofWallets {
+		wallet, err := ontsdk.OpenWallet(w.WalletFile)
+		if err != nil {
+			return nil, fmt.Errorf("loadProofSigners - failed to open wallet %s: %v", w.WalletFile, err)
+		}
+		for i := 1; i <= wallet.GetAccountCount(); i++ {
+			acc, err := wallet.GetAccountByIndex(i, []byte(w.WalletPwd))
+			if err != nil {
+				return nil, fmt.Errorf("loadProofSigners - failed to unlock account %d of %s: %v", i, w.WalletFile, err)
+			}
+			if acc.Address == headerSigner.Address {
+				continue
+			}
+			signers = append(signers, acc)
+		}
+	}
+	if len(signers) == 0 {
+		signers = append(signers, headerSigner)
+	}
+	for _, v := range signers {
+		proofLog.Infof("NewHecoManager - poly proof signer: %s", v.Address.ToBase58())
+	}
+	return signers, nil
+}
+
+// nextProofSigner returns the proof signers in round-robin order
+func (this *HecoManager) nextProofSigner() *sdk.Account {
+	idx := atomic.AddUint64(&this.proofSignerIdx, 1)
+	return this.proofSigners[idx%uint64(len(this.proofSigners))]
 }
 
 func (this *HecoManager) MonitorHecoChain() {
@@ -185,25 +267,30 @@ func (this *HecoManager) MonitorHecoChain() {
 	for {
 		select {
 		case <-fetchBlockTicker.C:
-			height, err := tools.GetNodeHeight(this.config.HecoConfig.RestURL, this.restClient)
+			health.Beat(HEARTBEAT_MONITOR_HECO_CHAIN)
+			if chainsDegraded("MonitorChain", this.client, this.polySdk) {
+				continue
+			}
+			height, err := this.client.GetNodeHeight()
 			if err != nil {
-				log.Infof("MonitorChain - cannot get node height, err: %s", err)
+				hecoScanLog.Infof("MonitorChain - cannot get node height, err: %s", err)
 				continue
 			}
 			if height-this.currentHeight <= this.config.HecoConfig.BlockConfig {
 				continue
 			}
-			log.Infof("MonitorChain - heco height is %d", height)
+			hecoScanLog.Infof("MonitorChain - heco height is %d", height)
 			blockHandleResult = true
 			for this.currentHeight < height-this.config.HecoConfig.BlockConfig {
 				if this.currentHeight%10 == 0 {
-					log.Infof("handle new heco Block height: %d", this.currentHeight)
+					hecoScanLog.Infof("handle new heco Block height: %d", this.currentHeight)
 				}
+				health.Beat(HEARTBEAT_MONITOR_HECO_CHAIN)
 				blockHandleResult = this.CheckIfCommitedToPolyAndParseLockDepositEvent(this.currentHeight + 1)
 				if blockHandleResult == false {
 					break
 				}
-				this.currentHeight++
+				atomic.AddUint64(&this.currentHeight, 1)
 				// try to commit header if more than 50 headers needed to be syned
 				if len(this.header4sync) >= this.config.HecoConfig.HeadersPerBatch {
 					if res := this.commitHecoHeaderToPoly(); res != 0 {
@@ -227,16 +314,14 @@ func (this *HecoManager) init() error {
 	if latestHeight == 0 {
 		return fmt.Errorf("init - the genesis block has not synced!")
 	}
+	height := latestHeight
 	if this.forceHeight > 0 && this.forceHeight < latestHeight {
-		this.currentHeight = this.forceHeight
-	} else {
-		if latestHeight > this.config.HecoConfig.BlockConfig {
-			this.currentHeight = latestHeight - this.config.HecoConfig.BlockConfig
-		} else {
-			this.currentHeight = latestHeight
-		}
+		height = this.forceHeight
+	} else if latestHeight > this.config.HecoConfig.BlockConfig {
+		height = latestHeight - this.config.HecoConfig.BlockConfig
 	}
-	log.Infof("HecoManager init - start height: %d", this.currentHeight)
+	atomic.StoreUint64(&this.currentHeight, height)
+	hecoScanLog.Infof("HecoManager init - start height: %d", height)
 	return nil
 }
 
@@ -261,13 +346,13 @@ func (this *HecoManager) findLastestHeight() uint64 {
 func (this *HecoManager) CheckIfCommitedToPolyAndParseLockDepositEvent(height uint64) bool {
 	ret := this.handleBlockHeader(height)
 	if !ret {
-		log.Warnf("handleNewBlock - handleBlockHeader on height :%d failed, retrying", height)
+		hecoScanLog.Warnf("handleNewBlock - handleBlockHeader on height :%d failed, retrying", height)
 		return false
 	}
 	for {
 		ret = this.fetchLockDepositEvents(height, this.client)
 		if !ret {
-			log.Errorf("handleNewBlock - fetchLockDepositEvents on height :%d failed", height)
+			hecoScanLog.Errorf("handleNewBlock - fetchLockDepositEvents on height :%d failed", height)
 			continue
 		}
 		break
@@ -277,9 +362,9 @@ func (this *HecoManager) CheckIfCommitedToPolyAndParseLockDepositEvent(height ui
 }
 
 func (this *HecoManager) handleBlockHeader(height uint64) bool {
-	hdr, err := this.client.HeaderByNumber(context.Background(), big.NewInt(int64(height)))
+	hdr, err := this.client.HeaderByNumberQuorum(context.Background(), big.NewInt(int64(height)))
 	if err != nil {
-		log.Warnf("handleBlockHeader - GetNodeHeader on height :%d failed, retrying", height)
+		hecoScanLog.Warnf("handleBlockHeader - GetNodeHeader on height :%d failed, retrying", height)
 		return false
 	}
 	rawHdr, _ := hdr.MarshalJSON()
@@ -287,12 +372,12 @@ func (this *HecoManager) handleBlockHeader(height uint64) bool {
 		append(append([]byte(scom.MAIN_CHAIN), autils.GetUint64Bytes(this.config.HecoConfig.SideChainId)...), autils.GetUint64Bytes(height)...))
 	if len(raw) == 0 || !bytes.Equal(raw, hdr.Hash().Bytes()) {
 		this.header4sync = append(this.header4sync, rawHdr)
-		//log.Infof("rawHeader height: %d", hdr.Number)
+		//hecoScanLog.Infof("rawHeader height: %d", hdr.Number)
 	}
 	return true
 }
 
-func (this *HecoManager) fetchLockDepositEvents(height uint64, client *ethclient.Client) bool {
+func (this *HecoManager) fetchLockDepositEvents(height uint64, client *tools.HecoClient) bool {
 	lockAddress := ethcommon.HexToAddress(this.config.HecoConfig.ECCMContractAddress)
 	lockContract, err := eccm_abi.NewEthCrossChainManager(lockAddress, client)
 	if err != nil {
@@ -305,14 +390,18 @@ func (this *HecoManager) fetchLockDepositEvents(height uint64, client *ethclient
 	}
 	events, err := lockContract.FilterCrossChainEvent(opt, nil)
 	if err != nil {
-		log.Errorf("fetchLockDepositEvents - FilterCrossChainEvent error :%s", err.Error())
+		hecoScanLog.Errorf("fetchLockDepositEvents - FilterCrossChainEvent error :%s", err.Error())
 		return false
 	}
 	if events == nil {
-		log.Infof("fetchLockDepositEvents - no events found on FilterCrossChainEvent")
+		hecoScanLog.Infof("fetchLockDepositEvents - no events found on FilterCrossChainEvent")
 		return false
 	}
 
+	// txs of the block are queued at once, a failed block is fetched again as a whole
+	batch := this.db.NewBatch()
+	found := make([]*CrossTransfer, 0)
+	loggers := make([]*log.Entry, 0)
 	for events.Next() {
 		evt := events.Event
 		var isTarget bool
@@ -344,24 +433,25 @@ func (this *HecoManager) fetchLockDepositEvents(height uint64, client *ethclient
 		// Filter skipped senders
 		_, skipped := this.skippedSenders[evt.Sender]
 		if skipped {
-			log.Infof("Skipped cross chain sender %s", evt.Sender)
+			hecoScanLog.Infof("Skipped cross chain sender %s", evt.Sender)
 			continue
 		}
 
 		param := &common2.MakeTxParam{}
 		err = param.Deserialization(common.NewZeroCopySource([]byte(evt.Rawdata)))
 		if err != nil {
-			log.Errorf("param.Deserialization error %v", err)
+			hecoScanLog.Errorf("param.Deserialization error %v", err)
 			continue
 		}
 		if !METHODS[param.Method] {
-			log.Errorf("target contract method invalid %s %s", param.Method, string(evt.Raw.TxHash.Bytes()))
+			hecoScanLog.Errorf("target contract method invalid %s %s", param.Method, string(evt.Raw.TxHash.Bytes()))
 			continue
 		}
+		logger := hecoScanLog.With(log.CorrelationID(this.config.HecoConfig.SideChainId, param.CrossChainID), log.String("heco_tx", evt.Raw.TxHash.Hex()))
 		raw, _ := this.polySdk.GetStorage(autils.CrossChainManagerContractAddress.ToHexString(),
 			append(append([]byte(cross_chain_manager.DONE_TX), autils.GetUint64Bytes(this.config.HecoConfig.SideChainId)...), param.CrossChainID...))
 		if len(raw) != 0 {
-			log.Debugf("fetchLockDepositEvents - ccid %s (tx_hash: %s) already on poly",
+			logger.Debugf("fetchLockDepositEvents - ccid %s (tx_hash: %s) already on poly",
 				hex.EncodeToString(param.CrossChainID), evt.Raw.TxHash.Hex())
 			continue
 		}
@@ -376,18 +466,24 @@ func (this *HecoManager) fetchLockDepositEvents(height uint64, client *ethclient
 		}
 		sink := common.NewZeroCopySink(nil)
 		crossTx.Serialization(sink)
-		err = this.db.PutRetry(sink.Bytes())
-		if err != nil {
-			log.Errorf("fetchLockDepositEvents - this.db.PutRetry error: %s", err)
-		}
-		log.Infof("fetchLockDepositEvent found cross chain tx: %s -  height: %d", evt.Raw.TxHash.String(), height)
+		batch.PutRetry(sink.Bytes())
+		found = append(found, crossTx)
+		loggers = append(loggers, logger)
+	}
+	if err := batch.Commit(); err != nil {
+		hecoScanLog.Errorf("fetchLockDepositEvents - failed to queue %d txs at height %d: %s", len(found), height, err)
+		return false
+	}
+	for i, crossTx := range found {
+		loggers[i].Infof("fetchLockDepositEvent found cross chain tx: %s -  height: %d", ethcommon.BytesToHash(crossTx.txId).String(), height)
+		trackTransfer(this.db, loggers[i], this.transferUpdate(crossTx, db.TRANSFER_DETECTED))
 	}
 	return true
 }
 
 func (this *HecoManager) commitHecoHeaderToPoly() int {
 	start := time.Now()
-	tx, err := this.polySdk.Native.Hs.SyncBlockHeader(
+	tx, err := this.polySdk.SyncBlockHeader(
 		this.config.HecoConfig.SideChainId,
 		this.polySigner.Address,
 		this.header4sync,
@@ -396,11 +492,12 @@ func (this *HecoManager) commitHecoHeaderToPoly() int {
 	if err != nil {
 		errDesc := err.Error()
 		if strings.Contains(errDesc, "parent header not exist") || strings.Contains(errDesc, "missing required field") {
-			log.Warnf("commitHeader - send transaction to poly chain err: %s", errDesc)
+			headerSyncLog.Warnf("commitHeader - send transaction to poly chain err: %s", errDesc)
 			this.rollBackToCommAncestor()
 			return 0
 		} else {
-			log.Errorf("commitHeader - send transaction to poly chain err: %s", errDesc)
+			headerSyncLog.Errorf("commitHeader - send transaction to poly chain err: %s", errDesc)
+			this.notifyHeaderSyncFailure("", errDesc)
 			return 1
 		}
 	}
@@ -412,48 +509,154 @@ func (this *HecoManager) commitHecoHeaderToPoly() int {
 		if h > 0 && curr > h {
 			break
 		}
-		log.Infof("HecoManager SyncBlockHeader wait duration %s", time.Now().Sub(start).String())
+		headerSyncLog.Infof("HecoManager SyncBlockHeader wait duration %s", time.Now().Sub(start).String())
+		time.Sleep(time.Second)
+	}
+	headerSyncLog.Infof("commitHeader - send transaction %s to poly chain and confirmed on height %d", tx.ToHexString(), h)
+	res, err := this.checkHeaderSyncResult(tx.ToHexString())
+	for res == HEADER_SYNC_UNKNOWN {
+		headerSyncLog.Warnf("commitHeader - poly tx %s: %s, retry", tx.ToHexString(), err)
 		time.Sleep(time.Second)
+		res, err = this.checkHeaderSyncResult(tx.ToHexString())
+	}
+	switch res {
+	case HEADER_SYNC_NO_PARENT:
+		headerSyncLog.Warnf("commitHeader - poly tx %s: %s", tx.ToHexString(), err)
+		this.rollBackToCommAncestor()
+		return 0
+	case HEADER_SYNC_FAILED:
+		headerSyncLog.Errorf("commitHeader - poly tx %s: %s", tx.ToHexString(), err)
+		this.notifyHeaderSyncFailure(tx.ToHexString(), err.Error())
+		this.rollBackToCommAncestor()
+		return 1
 	}
-	log.Infof("commitHeader - send transaction %s to poly chain and confirmed on height %d", tx.ToHexString(), h)
 	this.header4sync = make([][]byte, 0)
 	return 0
 }
 
+func (this *HecoManager) notifyHeaderSyncFailure(polyTx string, reason string) {
+	notify.Notify(&notify.Event{
+		Kind:    notify.EVENT_HEADER_SYNC_FAILED,
+		Subject: "heco",
+		Message: fmt.Sprintf("failed to sync heco headers to poly: %s", reason),
+		Fields:  map[string]string{"poly_tx": polyTx},
+	})
+}
+
+type headerSyncResult int
+
+const (
+	HEADER_SYNC_DONE      headerSyncResult = iota
+	HEADER_SYNC_FAILED                     // tx not executed successfully on poly
+	HEADER_SYNC_NO_PARENT                  // tx executed but some headers were skipped for lack of parent
+	HEADER_SYNC_UNKNOWN                    // result not available yet, check again later
+)
+
+// checkHeaderSyncResult reads the event of a confirmed SyncBlockHeader tx and
+// makes sure every header in header4sync has been accepted by poly. Headers
+// whose parent is unknown are skipped silently by the native contract, so
+// they only show up as missing syncHeader notifications. HEADER_SYNC_UNKNOWN
+// is returned when poly can't be queried or hasn't indexed the event yet.
+func (this *HecoManager) checkHeaderSyncResult(txHash string) (headerSyncResult, error) {
+	event, err := this.polySdk.GetSmartContractEvent(txHash)
+	if err != nil {
+		return HEADER_SYNC_UNKNOWN, fmt.Errorf("failed to get smart contract event: %v", err)
+	}
+	if event == nil {
+		return HEADER_SYNC_UNKNOWN, fmt.Errorf("no smart contract event found")
+	}
+	if event.State != 1 {
+		return HEADER_SYNC_FAILED, fmt.Errorf("header sync failed on poly, state: %d", event.State)
+	}
+	synced := make(map[string]bool)
+	for _, notify := range event.Notify {
+		if notify.ContractAddress != autils.HeaderSyncContractAddress.ToHexString() {
+			continue
+		}
+		states, ok := notify.States.([]interface{})
+		if !ok || len(states) < 4 {
+			continue
+		}
+		method, _ := states[0].(string)
+		if method != scom.SYNC_HEADER_NAME {
+			continue
+		}
+		hash, _ := states[3].(string)
+		synced[strings.ToLower(hash)] = true
+	}
+	for _, raw := range this.header4sync {
+		hdr := &types.Header{}
+		if err := hdr.UnmarshalJSON(raw); err != nil {
+			return HEADER_SYNC_FAILED, fmt.Errorf("failed to unmarshal synced header: %v", err)
+		}
+		if synced[strings.ToLower(hdr.Hash().Hex())] {
+			continue
+		}
+		// header already on poly before this tx was executed
+		stored, err := this.polySdk.GetStorage(autils.HeaderSyncContractAddress.ToHexString(),
+			append(append([]byte(scom.HEADER_INDEX), autils.GetUint64Bytes(this.config.HecoConfig.SideChainId)...), hdr.Hash().Bytes()...))
+		if err != nil {
+			return HEADER_SYNC_UNKNOWN, fmt.Errorf("failed to get header %s from poly: %v", hdr.Hash().Hex(), err)
+		}
+		if len(stored) != 0 {
+			continue
+		}
+		return HEADER_SYNC_NO_PARENT, fmt.Errorf("header %s (height: %d) not synced, parent header not exist", hdr.Hash().Hex(), hdr.Number.Uint64())
+	}
+	return HEADER_SYNC_DONE, nil
+}
+
 func (this *HecoManager) rollBackToCommAncestor() {
-	for ; ; this.currentHeight-- {
+	height := this.currentHeight
+	for ; ; height-- {
 		raw, err := this.polySdk.GetStorage(autils.HeaderSyncContractAddress.ToHexString(),
-			append(append([]byte(scom.MAIN_CHAIN), autils.GetUint64Bytes(this.config.HecoConfig.SideChainId)...), autils.GetUint64Bytes(this.currentHeight)...))
+			append(append([]byte(scom.MAIN_CHAIN), autils.GetUint64Bytes(this.config.HecoConfig.SideChainId)...), autils.GetUint64Bytes(height)...))
 		if len(raw) == 0 || err != nil {
 			continue
 		}
-		hdr, err := this.client.HeaderByNumber(context.Background(), big.NewInt(int64(this.currentHeight)))
+		hdr, err := this.client.HeaderByNumber(context.Background(), big.NewInt(int64(height)))
 		if err != nil {
-			log.Errorf("rollBackToCommAncestor - failed to get header by number, so we wait for one second to retry: %v", err)
+			hecoScanLog.Errorf("rollBackToCommAncestor - failed to get header by number, so we wait for one second to retry: %v", err)
 			time.Sleep(time.Second)
-			this.currentHeight++
+			height++
+			continue
 		}
 		if bytes.Equal(hdr.Hash().Bytes(), raw) {
-			log.Infof("rollBackToCommAncestor - find the common ancestor: %s(number: %d)", hdr.Hash().String(), this.currentHeight)
+			hecoScanLog.Infof("rollBackToCommAncestor - find the common ancestor: %s(number: %d)", hdr.Hash().String(), height)
 			break
 		}
 	}
+	atomic.StoreUint64(&this.currentHeight, height)
 	this.header4sync = make([][]byte, 0)
 }
 
 func (this *HecoManager) RegularlyTryCommitHecoLockProofToPoly() {
+	workerNum := this.config.HecoConfig.ProofWorkerNum
+	if workerNum <= 0 {
+		workerNum = len(this.proofSigners)
+	}
+	this.proofTasks = make(chan *proofTask, workerNum)
+	for i := 0; i < workerNum; i++ {
+		go this.proofWorker()
+	}
+	defer close(this.proofTasks)
+
 	monitorTicker := time.NewTicker(time.Duration(this.config.HecoConfig.MonitorInterval) * time.Second)
 	for {
 		select {
 		case <-monitorTicker.C:
-			height, err := tools.GetNodeHeight(this.config.HecoConfig.RestURL, this.restClient)
+			health.Beat(HEARTBEAT_COMMIT_HECO_PROOF)
+			if chainsDegraded("MonitorDeposit", this.client, this.polySdk) {
+				continue
+			}
+			height, err := this.client.GetNodeHeight()
 			if err != nil {
-				log.Infof("MonitorDeposit - cannot get heco node height, err: %s", err)
+				proofLog.Infof("MonitorDeposit - cannot get heco node height, err: %s", err)
 				continue
 			}
 			snycheight := this.findLastestHeight()
 			if height < snycheight {
-				log.Warnf("heco node latest height: %d lower than poly synced height: %d, retry fetch heco node height", height, snycheight)
+				proofLog.Warnf("heco node latest height: %d lower than poly synced height: %d, retry fetch heco node height", height, snycheight)
 				continue
 			}
 			log.Log.Info("MonitorDeposit from heco - snyced heco height", snycheight, "heco height", height, "diff", height-snycheight)
@@ -469,81 +672,209 @@ func (this *HecoManager) handleCachedLockDepositEvents(refHeight uint64) error {
 		return fmt.Errorf("handleLockDepositEvents - this.db.GetAllRetry error: %s", err)
 	}
 	for _, v := range retryList {
-		// time.Sleep(time.Second * 1)
-		crosstx := new(CrossTransfer)
-		err := crosstx.Deserialization(common.NewZeroCopySource(v))
-		if err != nil {
-			log.Errorf("handleCachedLockDepositEvents - retry.Deserialization error: %s", err)
-			continue
-		}
-		//1. decode events
-		key := crosstx.txIndex
-		keyBytes, err := eth.MappingKeyAt(key, "01")
-		if err != nil {
-			log.Errorf("handleCachedLockDepositEvents - MappingKeyAt error:%s\n", err.Error())
+		// entries still handled by a worker from a previous round are skipped
+		if !this.markProofInflight(v) {
 			continue
 		}
-		if refHeight <= crosstx.height+this.config.HecoConfig.CommitProofBlockConfig {
-			continue
+		this.proofTasks <- &proofTask{
+			refHeight: refHeight,
+			retry:     v,
 		}
-		height := int64(refHeight - this.config.HecoConfig.CommitProofBlockConfig)
-		heightHex := hexutil.EncodeBig(big.NewInt(height))
-		proofKey := hexutil.Encode(keyBytes)
-		//2. get proof
-		proof, err := tools.GetProof(this.config.HecoConfig.RestURL, this.config.HecoConfig.ECCDContractAddress, proofKey, heightHex, this.restClient)
-		if err != nil {
-			log.Errorf("handleCachedLockDepositEvents, proofKey: %s, tx height: %d, proof height: %d - error :%s\n", proofKey, crosstx.height, height, err.Error())
-			continue
-		}
-		//3. commit proof to poly
-		txHash, err := this.commitProof(uint32(height), proof, crosstx.value, crosstx.txId)
-		if err != nil {
-			if strings.Contains(err.Error(), "chooseUtxos, current utxo is not enough") {
-				log.Infof("handleCachedLockDepositEvents - invokeNativeContract error: %s", err)
-				continue
-			} else if strings.Contains(err.Error(), "tx already done") {
-				log.Debugf("handleLockDepositEvents - heco_tx %s already on poly", ethcommon.BytesToHash(crosstx.txId).String())
-				if err := this.db.DeleteRetry(v); err != nil {
-					log.Errorf("handleLockDepositEvents - this.db.DeleteRetry error: %s", err)
-				}
-				continue
-			} else {
-				log.Errorf("handleCachedLockDepositEvents - commitProof to poly error for heco_tx %s: %s", ethcommon.BytesToHash(crosstx.txId).String(), err)
-				continue
+	}
+	return nil
+}
+
+func (this *HecoManager) proofWorker() {
+	for task := range this.proofTasks {
+		this.handleCachedLockDepositEvent(task.refHeight, task.retry, this.nextProofSigner())
+		this.unmarkProofInflight(task.retry)
+	}
+}
+
+func (this *HecoManager) markProofInflight(retry []byte) bool {
+	this.proofLock.Lock()
+	defer this.proofLock.Unlock()
+	if this.proofInflight[string(retry)] {
+		return false
+	}
+	this.proofInflight[string(retry)] = true
+	return true
+}
+
+func (this *HecoManager) unmarkProofInflight(retry []byte) {
+	this.proofLock.Lock()
+	defer this.proofLock.Unlock()
+	delete(this.proofInflight, string(retry))
+}
+
+func (this *HecoManager) handleCachedLockDepositEvent(refHeight uint64, v []byte, signer *sdk.Account) {
+	crosstx := new(CrossTransfer)
+	err := crosstx.Deserialization(common.NewZeroCopySource(v))
+	if err != nil {
+		proofLog.Errorf("handleCachedLockDepositEvents - retry.Deserialization error: %s", err)
+		return
+	}
+	logger := this.transferLog(crosstx)
+	//1. decode events
+	key := crosstx.txIndex
+	keyBytes, err := eth.MappingKeyAt(key, "01")
+	if err != nil {
+		logger.Errorf("handleCachedLockDepositEvents - MappingKeyAt error:%s\n", err.Error())
+		return
+	}
+	if refHeight <= crosstx.height+this.config.HecoConfig.CommitProofBlockConfig {
+		return
+	}
+	height := int64(refHeight - this.config.HecoConfig.CommitProofBlockConfig)
+	proofKey := hexutil.Encode(keyBytes)
+	//2. get proof, reuse the cached one if its header is still the one on poly
+	proof, proofHeight, err := this.getProof(proofKey, crosstx.value, crosstx.height, uint64(height))
+	if err != nil {
+		logger.Errorf("handleCachedLockDepositEvents, proofKey: %s, tx height: %d, requested height: %d, proof height: %d - error :%s\n",
+			proofKey, crosstx.height, height, proofHeight, err.Error())
+		return
+	}
+	//3. commit proof to poly
+	txHash, err := this.commitProof(uint32(proofHeight), proof, crosstx.value, crosstx.txId, signer, logger)
+	if err != nil {
+		if strings.Contains(err.Error(), "chooseUtxos, current utxo is not enough") {
+			logger.Infof("handleCachedLockDepositEvents - invokeNativeContract error: %s", err)
+			return
+		} else if strings.Contains(err.Error(), "tx already done") {
+			logger.Debugf("handleLockDepositEvents - heco_tx %s already on poly", ethcommon.BytesToHash(crosstx.txId).String())
+			this.proofCache.RemoveAll(this.config.HecoConfig.ECCDContractAddress, proofKey)
+			if err := this.db.DeleteRetry(v); err != nil {
+				logger.Errorf("handleLockDepositEvents - this.db.DeleteRetry error: %s", err)
+			}
+			update := this.transferUpdate(crosstx, db.TRANSFER_POLY_CONFIRMED)
+			update.Desc = "already done on poly"
+			trackTransfer(this.db, logger, update)
+			return
+		} else {
+			// rejected by poly, the proof at this height is not trusted any more
+			var rejected *tools.PolyRpcError
+			if errors.As(err, &rejected) {
+				this.proofCache.Remove(this.config.HecoConfig.ECCDContractAddress, proofKey, uint64(proofHeight))
 			}
+			logger.Errorf("handleCachedLockDepositEvents - commitProof to poly error for heco_tx %s: %s", ethcommon.BytesToHash(crosstx.txId).String(), err)
+			return
 		}
-		//4. put to check db for checking
-		err = this.db.PutCheck(txHash, v)
-		if err != nil {
-			log.Errorf("handleCachedLockDepositEvents - this.db.PutCheck error: %s", err)
+	}
+	this.proofCache.RemoveAll(this.config.HecoConfig.ECCDContractAddress, proofKey)
+	//4. move it from retry to check db for checking
+	batch := this.db.NewBatch()
+	batch.PutCheck(txHash, v)
+	batch.DeleteRetry(v)
+	if err = batch.Commit(); err != nil {
+		logger.Errorf("handleCachedLockDepositEvents - failed to move tx to check db: %s", err)
+	}
+	update := this.transferUpdate(crosstx, db.TRANSFER_PROOF_SUBMITTED)
+	update.PolyTxHash = txHash
+	trackTransfer(this.db, logger, update)
+	logger.Infof("handleCachedLockDepositEvents - syncProofToAlia txHash is %s", txHash)
+}
+
+// getProof returns the proof of key in ECCD and the height it was taken at.
+// A cached proof is reused as long as it is above txHeight, not above
+// maxHeight and the header synced to poly at its height hasn't changed.
+// Fresh proofs are verified locally against value before being used.
+func (this *HecoManager) getProof(key string, value []byte, txHeight uint64, maxHeight uint64) ([]byte, int64, error) {
+	eccd := this.config.HecoConfig.ECCDContractAddress
+	for {
+		cached, ok := this.proofCache.Latest(eccd, key, txHeight, maxHeight)
+		if !ok {
+			break
 		}
-		err = this.db.DeleteRetry(v)
-		if err != nil {
-			log.Errorf("handleCachedLockDepositEvents - this.db.PutCheck error: %s", err)
+		if bytes.Equal(this.getPolySyncedHash(cached.Height), cached.BlockHash) {
+			proofLog.Debugf("getProof - reuse cached proof of key %s at height %d", key, cached.Height)
+			return cached.Proof, int64(cached.Height), nil
 		}
-		log.Infof("handleCachedLockDepositEvents - syncProofToAlia txHash is %s", txHash)
+		this.proofCache.Remove(eccd, key, cached.Height)
 	}
-	return nil
+	heightHex := hexutil.EncodeBig(new(big.Int).SetUint64(maxHeight))
+	proof, err := this.client.GetProof(eccd, key, heightHex)
+	if err != nil {
+		return nil, 0, err
+	}
+	hash := this.getPolySyncedHash(maxHeight)
+	if err = this.verifyProof(proof, maxHeight, hash, key, value); err != nil {
+		return nil, 0, err
+	}
+	this.proofCache.Put(eccd, key, &tools.CachedProof{
+		Height:    maxHeight,
+		BlockHash: hash,
+		Proof:     proof,
+	})
+	return proof, int64(maxHeight), nil
+}
+
+// verifyProof checks the proof against the heco header at height, which must be
+// the one poly has synced (polyHash), so a bad proof never costs a poly tx.
+func (this *HecoManager) verifyProof(proof []byte, height uint64, polyHash []byte, key string, value []byte) error {
+	if len(polyHash) == 0 {
+		return fmt.Errorf("verifyProof - no header synced to poly at height %d", height)
+	}
+	hdr, err := this.client.HeaderByNumberQuorum(context.Background(), new(big.Int).SetUint64(height))
+	if err != nil {
+		return fmt.Errorf("verifyProof - failed to get header at height %d: %v", height, err)
+	}
+	if !bytes.Equal(hdr.Hash().Bytes(), polyHash) {
+		return fmt.Errorf("verifyProof - header %s at height %d is not the one synced to poly %x", hdr.Hash().Hex(), height, polyHash)
+	}
+	return tools.VerifyProof(proof, hdr, this.config.HecoConfig.ECCDContractAddress, key, value)
 }
 
-func (this *HecoManager) commitProof(height uint32, proof []byte, value []byte, txhash []byte) (string, error) {
-	log.Debugf("commit proof, height: %d, proof: %s, value: %s, txhash: %s", height, string(proof), hex.EncodeToString(value), hex.EncodeToString(txhash))
-	tx, err := this.polySdk.Native.Ccm.ImportOuterTransfer(
+// getPolySyncedHash returns the hash of the heco header on poly's main chain at height
+func (this *HecoManager) getPolySyncedHash(height uint64) []byte {
+	raw, _ := this.polySdk.GetStorage(autils.HeaderSyncContractAddress.ToHexString(),
+		append(append([]byte(scom.MAIN_CHAIN), autils.GetUint64Bytes(this.config.HecoConfig.SideChainId)...), autils.GetUint64Bytes(height)...))
+	return raw
+}
+
+func (this *HecoManager) commitProof(height uint32, proof []byte, value []byte, txhash []byte, signer *sdk.Account, logger *log.Entry) (string, error) {
+	logger.Debugf("commit proof, height: %d, proof: %s, value: %s, txhash: %s, signer: %s", height, string(proof), hex.EncodeToString(value), hex.EncodeToString(txhash), signer.Address.ToBase58())
+	tx, err := this.polySdk.ImportOuterTransfer(
 		this.config.HecoConfig.SideChainId,
 		value,
 		height,
 		proof,
-		ethcommon.Hex2Bytes(this.polySigner.Address.ToHexString()),
+		ethcommon.Hex2Bytes(signer.Address.ToHexString()),
 		[]byte{},
-		this.polySigner)
+		signer)
 	if err != nil {
 		return "", err
 	} else {
-		log.Infof("commitProof - send transaction to poly chain: ( poly_txhash: %s, heco_txhash: %s, height: %d )",
+		logger.Infof("commitProof - send transaction to poly chain: ( poly_txhash: %s, heco_txhash: %s, height: %d )",
 			tx.ToHexString(), ethcommon.BytesToHash(txhash).String(), height)
 		return tx.ToHexString(), nil
 	}
 }
+
+// transferLog tags log lines with the correlation id of crosstx
+func (this *HecoManager) transferLog(crosstx *CrossTransfer) *log.Entry {
+	fields := []log.Field{log.String("heco_tx", ethcommon.BytesToHash(crosstx.txId).String())}
+	param := &common2.MakeTxParam{}
+	if err := param.Deserialization(common.NewZeroCopySource(crosstx.value)); err == nil {
+		fields = append(fields, log.CorrelationID(this.config.HecoConfig.SideChainId, param.CrossChainID))
+	}
+	return proofLog.With(fields...)
+}
+
+// transferUpdate moves the transfer of crosstx to state in the lifecycle store
+func (this *HecoManager) transferUpdate(crosstx *CrossTransfer, state db.TransferState) *db.TransferUpdate {
+	update := &db.TransferUpdate{
+		FromChainId: this.config.HecoConfig.SideChainId,
+		ToChainId:   uint64(crosstx.toChain),
+		SrcTxHash:   ethcommon.BytesToHash(crosstx.txId).String(),
+		State:       state,
+	}
+	param := &common2.MakeTxParam{}
+	if err := param.Deserialization(common.NewZeroCopySource(crosstx.value)); err == nil {
+		update.CrossChainId = param.CrossChainID
+	}
+	return update
+}
+
 func (this *HecoManager) parserValue(value []byte) []byte {
 	source := common.NewZeroCopySource(value)
 	txHash, eof := source.NextVarBytes()
@@ -558,6 +889,10 @@ func (this *HecoManager) CheckDeposit() {
 	for {
 		select {
 		case <-checkTicker.C:
+			health.Beat(HEARTBEAT_CHECK_HECO_DEPOSIT)
+			if chainsDegraded("CheckDeposit", nil, this.polySdk) {
+				continue
+			}
 			// try to check deposit
 			this.checkLockDepositEvents()
 		case <-this.exitChan:
@@ -571,24 +906,51 @@ func (this *HecoManager) checkLockDepositEvents() error {
 		return fmt.Errorf("checkLockDepositEvents - this.db.GetAllCheck error: %s", err)
 	}
 	for k, v := range checkMap {
+		crosstx := new(CrossTransfer)
+		logger := proofLog.With(log.String("poly_tx", k))
+		if err := crosstx.Deserialization(common.NewZeroCopySource(v)); err == nil {
+			logger = this.transferLog(crosstx).With(log.String("poly_tx", k))
+		}
 		event, err := this.polySdk.GetSmartContractEvent(k)
 		if err != nil {
-			log.Errorf("checkLockDepositEvents - this.aliaSdk.GetSmartContractEvent error: %s", err)
+			logger.Errorf("checkLockDepositEvents - this.aliaSdk.GetSmartContractEvent error: %s", err)
 			continue
 		}
 		if event == nil {
 			continue
 		}
 		if event.State != 1 {
-			log.Infof("checkLockDepositEvents - state of poly tx %s is not success", k)
-			err := this.db.PutRetry(v)
-			if err != nil {
-				log.Errorf("checkLockDepositEvents - this.db.PutRetry error:%s", err)
+			logger.Infof("checkLockDepositEvents - state of poly tx %s is not success", k)
+			// the proof may be the reason, fetch a fresh one on retry
+			if keyBytes, err := eth.MappingKeyAt(crosstx.txIndex, "01"); err == nil && crosstx.txIndex != "" {
+				this.proofCache.RemoveAll(this.config.HecoConfig.ECCDContractAddress, hexutil.Encode(keyBytes))
 			}
-		}
-		err = this.db.DeleteCheck(k)
-		if err != nil {
-			log.Errorf("checkLockDepositEvents - this.db.DeleteRetry error:%s", err)
+			batch := this.db.NewBatch()
+			batch.PutRetry(v)
+			batch.DeleteCheck(k)
+			if err := batch.Commit(); err != nil {
+				logger.Errorf("checkLockDepositEvents - failed to move tx back to retry db: %s", err)
+				continue
+			}
+			update := this.transferUpdate(crosstx, db.TRANSFER_POLY_FAILED)
+			update.PolyTxHash = k
+			update.Desc = fmt.Sprintf("poly tx state %d", event.State)
+			trackTransfer(this.db, logger, update)
+			notify.Notify(&notify.Event{
+				Kind:    notify.EVENT_RELAY_FAILED,
+				Subject: k,
+				Message: fmt.Sprintf("poly tx %s of heco tx %s failed, the proof will be committed again", k, update.SrcTxHash),
+				Fields:  map[string]string{"poly_tx": k, "heco_tx": update.SrcTxHash},
+			})
+		} else {
+			logger.Infof("checkLockDepositEvents - poly tx %s succeeded", k)
+			if err = this.db.DeleteCheck(k); err != nil {
+				logger.Errorf("checkLockDepositEvents - this.db.DeleteCheck error:%s", err)
+				continue
+			}
+			update := this.transferUpdate(crosstx, db.TRANSFER_POLY_CONFIRMED)
+			update.PolyTxHash = k
+			trackTransfer(this.db, logger, update)
 		}
 	}
 	return nil
@@ -0,0 +1,29 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package manager
+
+import "github.com/polynetwork/heco_relayer/log"
+
+// log modules of the relaying subsystems, their levels can be changed at runtime
+var (
+	hecoScanLog   = log.NewModule("heco_scanner")
+	headerSyncLog = log.NewModule("header_sync")
+	proofLog      = log.NewModule("proof_committer")
+	polyScanLog   = log.NewModule("poly_scanner")
+	senderLog     = log.NewModule("sender")
+	feeLog        = log.NewModule("fee_checker")
+)
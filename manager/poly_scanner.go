@@ -0,0 +1,268 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package manager
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/polynetwork/heco_relayer/config"
+	"github.com/polynetwork/heco_relayer/db"
+	"github.com/polynetwork/heco_relayer/health"
+	"github.com/polynetwork/heco_relayer/tools"
+	"github.com/polynetwork/poly/common"
+	polytypes "github.com/polynetwork/poly/core/types"
+	common2 "github.com/polynetwork/poly/native/service/cross_chain_manager/common"
+)
+
+// polyBlock is what the scanner needs from the poly block at height: the txs
+// to heco in it, proved against the header at height + 1
+type polyBlock struct {
+	height uint32
+	txs    []*BridgeTransaction
+	err    error
+}
+
+// crossTxKey locates the cross states proof of a makeProof event
+type crossTxKey struct {
+	polyTxHash string
+	key        string
+}
+
+// scanPolyBlocks handles the poly blocks from start to end and returns the
+// height to continue with. Up to ScanWindow blocks are fetched concurrently
+// ahead of the one being committed, blocks are committed in order together
+// with the cursor, so the scan stops at the first block that fails. At most
+// POLY_MAX_SCAN_BLOCKS blocks are handled per call, so a long backlog doesn't
+// keep the monitor loop from checking for exit.
+func (this *PolyManager) scanPolyBlocks(start, end uint32) uint32 {
+	epoch := this.pendingEpoch()
+	if epoch == EPOCH_UNKNOWN {
+		return start
+	}
+	// blocks are proved by the next header, which must be signed by bookkeepers heco knows
+	if epoch > EPOCH_SYNCED && int64(end)+1 >= epoch {
+		if int64(start)+1 >= epoch {
+			polyScanLog.Debugf("scanPolyBlocks - wait for poly epoch %d on heco before handling height %d", epoch, start)
+			return start
+		}
+		end = uint32(epoch) - 2
+	}
+	if end-start >= config.POLY_MAX_SCAN_BLOCKS {
+		end = start + config.POLY_MAX_SCAN_BLOCKS - 1
+	}
+	window := this.config.PolyConfig.ScanWindow
+	if window == 0 {
+		window = config.DEFAULT_POLY_SCAN_WINDOW
+	}
+
+	fetching := make([]chan *polyBlock, 0, window)
+	next := start
+	for height := start; height <= end; height++ {
+		for next <= end && uint64(len(fetching)) < window {
+			ch := make(chan *polyBlock, 1)
+			go func(height uint32) {
+				ch <- this.fetchPolyBlock(height)
+			}(next)
+			fetching = append(fetching, ch)
+			next++
+		}
+		blk := <-fetching[0]
+		fetching = fetching[1:]
+		health.Beat(HEARTBEAT_MONITOR_POLY_CHAIN)
+		if blk.err != nil {
+			polyScanLog.Errorf("scanPolyBlocks - failed to handle poly block %d: %v", height, blk.err)
+			return height
+		}
+		if err := this.commitPolyBlock(blk); err != nil {
+			polyScanLog.Errorf("scanPolyBlocks - failed to commit poly block %d: %v", height, err)
+			return height
+		}
+		if height%10 == 0 {
+			polyScanLog.Infof("handle new poly Block height: %d", height)
+		}
+	}
+	return end + 1
+}
+
+// fetchPolyBlock collects the txs to heco in the poly block at height, their
+// cross states proofs are fetched in parallel, ProofFetches at most over all
+// blocks being fetched
+func (this *PolyManager) fetchPolyBlock(height uint32) *polyBlock {
+	blk := &polyBlock{height: height}
+	lastEpoch := this.findLatestHeight()
+	hdr, err := this.polySdk.GetHeaderByHeight(height + 1)
+	if err != nil {
+		blk.err = fmt.Errorf("failed to get header %d: %v", height+1, err)
+		return blk
+	}
+	isCurr := lastEpoch < height+1
+	isEpoch, _, err := this.IsEpoch(hdr)
+	if err != nil {
+		blk.err = fmt.Errorf("falied to check isEpoch: %v", err)
+		return blk
+	}
+	var (
+		anchor *polytypes.Header
+		hp     string
+	)
+	anchorHeight := uint32(0)
+	if !isCurr {
+		anchorHeight = lastEpoch + 1
+	} else if isEpoch {
+		anchorHeight = height + 2
+	}
+	if anchorHeight != 0 {
+		if anchor, err = this.polySdk.GetHeaderByHeight(anchorHeight); err != nil {
+			blk.err = fmt.Errorf("failed to get anchor header %d: %v", anchorHeight, err)
+			return blk
+		}
+		proof, err := this.polySdk.GetMerkleProof(height+1, anchorHeight)
+		if err != nil {
+			blk.err = fmt.Errorf("failed to get merkle proof of %d at %d: %v", height+1, anchorHeight, err)
+			return blk
+		}
+		hp = proof.AuditPath
+	}
+
+	events, err := this.polySdk.GetSmartContractEventByBlock(height)
+	if err != nil {
+		blk.err = fmt.Errorf("failed to get block events: %v", err)
+		return blk
+	}
+	keys := make([]*crossTxKey, 0)
+	for _, event := range events {
+		for _, notify := range event.Notify {
+			if notify.ContractAddress != this.config.PolyConfig.EntranceContractAddress {
+				continue
+			}
+			states := notify.States.([]interface{})
+			method, _ := states[0].(string)
+			if method != "makeProof" {
+				continue
+			}
+			if uint64(states[2].(float64)) != this.config.HecoConfig.SideChainId {
+				continue
+			}
+			keys = append(keys, &crossTxKey{polyTxHash: event.TxHash, key: states[5].(string)})
+		}
+	}
+
+	txs := make([]*BridgeTransaction, len(keys))
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, k := range keys {
+		wg.Add(1)
+		go func(i int, k *crossTxKey) {
+			defer wg.Done()
+			this.proofFetches <- struct{}{}
+			proof, err := this.polySdk.GetCrossStatesProof(height, k.key)
+			<-this.proofFetches
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to get proof for key %s: %v", k.key, err)
+				return
+			}
+			auditpath, _ := hex.DecodeString(proof.AuditPath)
+			value, _, _, _ := tools.ParseAuditpath(auditpath)
+			param := &common2.ToMerkleValue{}
+			if err := param.Deserialization(common.NewZeroCopySource(value)); err != nil {
+				polyScanLog.Errorf("fetchPolyBlock - failed to deserialize MakeTxParam (value: %x, err: %v)", value, err)
+				return
+			}
+			if !this.isTarget(param, k.polyTxHash) {
+				return
+			}
+			txs[i] = &BridgeTransaction{
+				header:       hdr,
+				param:        param,
+				headerProof:  hp,
+				anchorHeader: anchor,
+				polyTxHash:   k.polyTxHash,
+				rawAuditPath: auditpath,
+				hasPay:       FEE_NOCHECK,
+				fee:          "",
+			}
+		}(i, k)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			blk.err = err
+			return blk
+		}
+	}
+	for _, tx := range txs {
+		if tx != nil {
+			blk.txs = append(blk.txs, tx)
+		}
+	}
+	return blk
+}
+
+// isTarget tells if param calls an allowed method of a target contract
+func (this *PolyManager) isTarget(param *common2.ToMerkleValue, polyTxHash string) bool {
+	if !METHODS[param.MakeTxParam.Method] {
+		polyScanLog.Errorf("Invalid target contract method %s %s", param.MakeTxParam.Method, polyTxHash)
+		return false
+	}
+	if len(this.config.TargetContracts) == 0 {
+		return true
+	}
+	toContractStr := ethcommon.BytesToAddress(param.MakeTxParam.ToContractAddress).String()
+	for _, v := range this.config.TargetContracts {
+		toChainIdArr, ok := v[toContractStr]
+		if !ok {
+			continue
+		}
+		if len(toChainIdArr["inbound"]) == 0 {
+			return true
+		}
+		for _, id := range toChainIdArr["inbound"] {
+			if id == param.FromChainID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// commitPolyBlock stores the txs of blk and moves the cursor to it at once
+func (this *PolyManager) commitPolyBlock(blk *polyBlock) error {
+	now := time.Now().Unix()
+	batch := this.db.NewBatch()
+	for _, tx := range blk.txs {
+		tx.createTime = now
+		sink := common.NewZeroCopySink(nil)
+		tx.Serialization(sink)
+		batch.PutBridgeTransactions(hex.EncodeToString(tx.param.MakeTxParam.TxHash), sink.Bytes())
+	}
+	batch.UpdatePolyHeight(blk.height)
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	for _, tx := range blk.txs {
+		logger := tx.logger(polyScanLog)
+		logger.Infof("commitPolyBlock - found poly tx to heco at height %d", blk.height)
+		update := tx.transferUpdate(db.TRANSFER_DETECTED)
+		update.ToChainId = this.config.HecoConfig.SideChainId
+		trackTransfer(this.db, logger, update)
+	}
+	return nil
+}
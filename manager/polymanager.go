@@ -24,9 +24,9 @@ import (
 	"fmt"
 	poly_bridge_sdk "github.com/polynetwork/poly-bridge/bridgesdk"
 	"math/big"
-	"math/rand"
-	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
@@ -34,15 +34,15 @@ import (
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ontio/ontology-crypto/keypair"
 	"github.com/ontio/ontology-crypto/signature"
 	"github.com/polynetwork/eth-contracts/go_abi/eccd_abi"
 	"github.com/polynetwork/eth-contracts/go_abi/eccm_abi"
 	"github.com/polynetwork/heco_relayer/config"
 	"github.com/polynetwork/heco_relayer/db"
+	"github.com/polynetwork/heco_relayer/health"
 	"github.com/polynetwork/heco_relayer/log"
-	sdk "github.com/polynetwork/poly-go-sdk"
+	"github.com/polynetwork/heco_relayer/notify"
 	"github.com/polynetwork/poly/common"
 	"github.com/polynetwork/poly/common/password"
 	vconfig "github.com/polynetwork/poly/consensus/vbft/config"
@@ -54,12 +54,21 @@ import (
 )
 
 const (
-	ChanLen = 1
+	COMMIT_RETRY    = iota // keep the tx and try again in the next round
+	COMMIT_DONE            // the tx is queued, relayed or skipped
+	COMMIT_DEFERRED        // the fee does not cover the gas now
 )
+
+// fee states of a bridge transaction: NOCHECK -> HASPAY, or NOCHECK ->
+// PENDING_RECHECK -> HASPAY / EXPIRED when the fee is not found paid.
+// UNCHECKED txs are relayed by policy, e.g. allow-listed, and skip the
+// profit check.
 const (
 	FEE_NOCHECK = iota
 	FEE_HASPAY
-	FEE_NOTPAY
+	FEE_PENDING_RECHECK
+	FEE_EXPIRED
+	FEE_UNCHECKED
 )
 
 type BridgeTransaction struct {
@@ -71,15 +80,39 @@ type BridgeTransaction struct {
 	rawAuditPath []byte
 	hasPay       uint8
 	fee          string
+	createTime   int64  // unix seconds the tx was found on poly
+	nextCheck    int64  // unix seconds to check the fee again in FEE_PENDING_RECHECK
+	dropReason   string // why the tx was not relayed, also the reason of the last failed fee check
 }
 
+const (
+	MAX_GAS_LIMIT       = 300000
+	MAX_SEND_TX_RETRIES = 10
+)
+
 func CheckGasLimit(hash string, limit uint64) error {
-	if limit > 300000 {
+	if limit > MAX_GAS_LIMIT {
 		return fmt.Errorf("Skipping poly tx %s for gas limit too high %d ", hash, limit)
 	}
 	return nil
 }
 
+// logger tags log lines with the correlation id of the transfer
+func (this *BridgeTransaction) logger(module *log.Module) *log.Entry {
+	return module.With(log.CorrelationID(this.param.FromChainID, this.param.MakeTxParam.CrossChainID),
+		log.String("poly_tx", this.polyTxHash))
+}
+
+func (this *BridgeTransaction) transferUpdate(state db.TransferState) *db.TransferUpdate {
+	return &db.TransferUpdate{
+		FromChainId:  this.param.FromChainID,
+		CrossChainId: this.param.MakeTxParam.CrossChainID,
+		SrcTxId:      hex.EncodeToString(this.param.MakeTxParam.TxHash),
+		PolyTxHash:   this.polyTxHash,
+		State:        state,
+	}
+}
+
 func (this *BridgeTransaction) Serialization(sink *common.ZeroCopySink) {
 	this.header.Serialization(sink)
 	this.param.Serialization(sink)
@@ -94,6 +127,9 @@ func (this *BridgeTransaction) Serialization(sink *common.ZeroCopySink) {
 	sink.WriteVarBytes(this.rawAuditPath)
 	sink.WriteUint8(this.hasPay)
 	sink.WriteString(this.fee)
+	sink.WriteInt64(this.createTime)
+	sink.WriteInt64(this.nextCheck)
+	sink.WriteString(this.dropReason)
 }
 
 func (this *BridgeTransaction) Deserialization(source *common.ZeroCopySource) error {
@@ -135,23 +171,42 @@ func (this *BridgeTransaction) Deserialization(source *common.ZeroCopySource) er
 	if eof {
 		return fmt.Errorf("Waiting deserialize fee error")
 	}
+	this.createTime, eof = source.NextInt64()
+	if eof {
+		// stored before create time was recorded
+		this.createTime = time.Now().Unix()
+		return nil
+	}
+	this.nextCheck, eof = source.NextInt64()
+	if eof {
+		return nil
+	}
+	this.dropReason, eof = source.NextString()
+	if eof {
+		return fmt.Errorf("Waiting deserialize drop reason error")
+	}
 	return nil
 }
 
 type PolyManager struct {
 	config        *config.ServiceConfig
-	polySdk       *sdk.PolySdk
-	currentHeight uint32
+	polySdk       *tools.PolyClient
+	currentHeight uint32 // only written by the scanner, read atomically elsewhere
 	contractAbi   *abi.ABI
 	exitChan      chan int
 	db            *db.BoltDB
-	ethClient     *ethclient.Client
+	ethClient     *tools.HecoClient
 	senders       []*EthSender
-	bridgeSdk     *poly_bridge_sdk.BridgeSdk
-	eccdInstance  *eccd_abi.EthCrossChainData
+	selector      SenderSelector
+	feeChecker    FeeChecker
+	profit        *ProfitGate
+	deferred      map[string]int64 // unprofitable tx => unix time to check it again
+	epochCache    *epochCache
+	epoch         int64         // see pendingEpoch
+	proofFetches  chan struct{} // limits the concurrent GetCrossStatesProof calls
 }
 
-func NewPolyManager(servCfg *config.ServiceConfig, startblockHeight uint32, polySdk *sdk.PolySdk, ethereumsdk *ethclient.Client, boltDB *db.BoltDB) (*PolyManager, error) {
+func NewPolyManager(servCfg *config.ServiceConfig, startblockHeight uint32, polySdk *tools.PolyClient, ethereumsdk *tools.HecoClient, boltDB *db.BoltDB) (*PolyManager, error) {
 	contractabi, err := abi.JSON(strings.NewReader(eccm_abi.EthCrossChainManagerABI))
 	if err != nil {
 		return nil, err
@@ -177,7 +232,14 @@ func NewPolyManager(servCfg *config.ServiceConfig, startblockHeight uint32, poly
 	if err = ks.UnlockKeys(servCfg.HecoConfig); err != nil {
 		return nil, err
 	}
+	health.AddReadiness("heco_keystore", ks.CheckUnlocked)
 
+	address := ethcommon.HexToAddress(servCfg.HecoConfig.ECCDContractAddress)
+	instance, err := eccd_abi.NewEthCrossChainData(address, ethereumsdk)
+	if err != nil {
+		log.Errorf("NewPolyManager - new eth cross chain failed: %s", err.Error())
+		return nil, fmt.Errorf("new eccd instance from abi error")
+	}
 	senders := make([]*EthSender, len(accArr))
 	for i, v := range senders {
 		v = &EthSender{}
@@ -188,19 +250,34 @@ func NewPolyManager(servCfg *config.ServiceConfig, startblockHeight uint32, poly
 		v.config = servCfg
 		v.polySdk = polySdk
 		v.contractAbi = &contractabi
+		v.eccd = instance
 		v.nonceManager = tools.NewNonceManager(ethereumsdk)
-		v.cmap = make(map[string]chan *EthTxInfo)
+		if v.queue, err = newSenderQueue(v, boltDB); err != nil {
+			return nil, err
+		}
 
 		senders[i] = v
 	}
-	bridgeSdk := poly_bridge_sdk.NewBridgeSdk(servCfg.BridgeUrl[0][0])
-	address := ethcommon.HexToAddress(servCfg.HecoConfig.ECCDContractAddress)
-	instance, err := eccd_abi.NewEthCrossChainData(address, ethereumsdk)
+	selector, err := NewSenderSelector(servCfg.HecoConfig.SenderSelector)
 	if err != nil {
-		log.Errorf("NewPolyManager - new eth cross chain failed: %s", err.Error())
-		return nil, fmt.Errorf("new eccd instance from abi error")
+		return nil, err
 	}
-	return &PolyManager{
+	feeChecker, err := NewFeeChecker(servCfg)
+	if err != nil {
+		return nil, err
+	}
+	profit, err := NewProfitGate(servCfg.ProfitConfig)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range senders {
+		v.profit = profit
+	}
+	proofFetches := servCfg.PolyConfig.ProofFetches
+	if proofFetches == 0 {
+		proofFetches = config.DEFAULT_POLY_PROOF_FETCHES
+	}
+	mgr := &PolyManager{
 		exitChan:      make(chan int),
 		config:        servCfg,
 		polySdk:       polySdk,
@@ -209,15 +286,37 @@ func NewPolyManager(servCfg *config.ServiceConfig, startblockHeight uint32, poly
 		db:            boltDB,
 		ethClient:     ethereumsdk,
 		senders:       senders,
-		bridgeSdk:     bridgeSdk,
-		eccdInstance:  instance,
-	}, nil
+		selector:      selector,
+		feeChecker:    feeChecker,
+		profit:        profit,
+		deferred:      make(map[string]int64),
+		epochCache:    newEpochCache(instance),
+		epoch:         EPOCH_UNKNOWN,
+		proofFetches:  make(chan struct{}, proofFetches),
+	}
+	mgr.refreshBalances()
+	health.AddReadiness("poly_cursor", mgr.checkCursorLag)
+	health.AddReadiness("heco_senders", mgr.checkSenders)
+	return mgr, nil
+}
+
+// checkCursorLag fails when the poly scanner falls too far behind the poly head
+func (this *PolyManager) checkCursorLag() error {
+	maxLag := this.config.PolyConfig.MaxCursorLag
+	if maxLag == 0 {
+		maxLag = config.DEFAULT_POLY_MAX_CURSOR_LAG
+	}
+	head := this.polySdk.Status().Height
+	if cursor := uint64(atomic.LoadUint32(&this.currentHeight)); head > cursor+maxLag {
+		return fmt.Errorf("poly scanner at %d is %d blocks behind head %d", cursor, head-cursor, head)
+	}
+	return nil
 }
 
 func (this *PolyManager) findLatestHeight() uint32 {
-	height, err := this.eccdInstance.GetCurEpochStartHeight(nil)
+	height, _, err := this.epochCache.get()
 	if err != nil {
-		log.Errorf("findLatestHeight - GetLatestHeight failed: %s", err.Error())
+		polyScanLog.Errorf("findLatestHeight - GetLatestHeight failed: %s", err.Error())
 		return 0
 	}
 	return uint32(height)
@@ -225,17 +324,18 @@ func (this *PolyManager) findLatestHeight() uint32 {
 
 func (this *PolyManager) init() bool {
 	if this.currentHeight > 0 {
-		log.Infof("PolyManager init - start height from flag: %d", this.currentHeight)
+		polyScanLog.Infof("PolyManager init - start height from flag: %d", this.currentHeight)
 		return true
 	}
-	this.currentHeight = this.db.GetPolyHeight()
+	height := this.db.GetPolyHeight()
 	latestHeight := this.findLatestHeight()
-	if latestHeight > this.currentHeight {
-		this.currentHeight = latestHeight
-		log.Infof("PolyManager init - latest height from ECCM: %d", this.currentHeight)
+	if latestHeight > height {
+		atomic.StoreUint32(&this.currentHeight, latestHeight)
+		polyScanLog.Infof("PolyManager init - latest height from ECCM: %d", latestHeight)
 		return true
 	}
-	log.Infof("PolyManager init - latest height from DB: %d", this.currentHeight)
+	atomic.StoreUint32(&this.currentHeight, height)
+	polyScanLog.Infof("PolyManager init - latest height from DB: %d", height)
 
 	return true
 }
@@ -243,40 +343,27 @@ func (this *PolyManager) init() bool {
 func (this *PolyManager) MonitorPolyChain() {
 	ret := this.init()
 	if ret == false {
-		log.Errorf("MonitorChain - init failed\n")
+		polyScanLog.Errorf("MonitorChain - init failed\n")
 	}
 	monitorTicker := time.NewTicker(config.POLY_MONITOR_INTERVAL)
-	var blockHandleResult bool
 	for {
 		select {
 		case <-monitorTicker.C:
+			health.Beat(HEARTBEAT_MONITOR_POLY_CHAIN)
+			if chainsDegraded("MonitorPolyChain", this.ethClient, this.polySdk) {
+				continue
+			}
 			latestheight, err := this.polySdk.GetCurrentBlockHeight()
 			if err != nil {
-				log.Errorf("MonitorChain - get poly chain block height error: %s", err)
+				polyScanLog.Errorf("MonitorChain - get poly chain block height error: %s", err)
 				continue
 			}
 			latestheight--
 			if latestheight-this.currentHeight < config.POLY_USEFUL_BLOCK_NUM {
 				continue
 			}
-			log.Infof("MonitorChain - poly chain current height: %d", latestheight)
-			blockHandleResult = true
-			for this.currentHeight <= latestheight-config.POLY_USEFUL_BLOCK_NUM {
-				if this.currentHeight%10 == 0 {
-					log.Infof("handle new poly Block height: %d", this.currentHeight)
-				}
-				blockHandleResult = this.handleDepositEvents(this.currentHeight)
-				if blockHandleResult == false {
-					break
-				}
-				this.currentHeight++
-				if this.currentHeight%1000 == 0 {
-					break
-				}
-			}
-			if err = this.db.UpdatePolyHeight(this.currentHeight - 1); err != nil {
-				log.Errorf("MonitorChain - failed to save height of poly: %v", err)
-			}
+			polyScanLog.Infof("MonitorChain - poly chain current height: %d", latestheight)
+			atomic.StoreUint32(&this.currentHeight, this.scanPolyBlocks(this.currentHeight, latestheight-config.POLY_USEFUL_BLOCK_NUM))
 		case <-this.exitChan:
 			return
 		}
@@ -292,14 +379,9 @@ func (this *PolyManager) IsEpoch(hdr *polytypes.Header) (bool, []byte, error) {
 		return false, nil, nil
 	}
 
-	eccdAddr := ethcommon.HexToAddress(this.config.HecoConfig.ECCDContractAddress)
-	eccd, err := eccd_abi.NewEthCrossChainData(eccdAddr, this.ethClient)
+	_, rawKeepers, err := this.epochCache.get()
 	if err != nil {
-		return false, nil, fmt.Errorf("failed to new eccm: %v", err)
-	}
-	rawKeepers, err := eccd.GetCurEpochConPubKeyBytes(nil)
-	if err != nil {
-		return false, nil, fmt.Errorf("failed to get current epoch keepers: %v", err)
+		return false, nil, err
 	}
 
 	var bookkeepers []keypair.PublicKey
@@ -323,146 +405,20 @@ func (this *PolyManager) IsEpoch(hdr *polytypes.Header) (bool, []byte, error) {
 	return true, publickeys, nil
 }
 
-func (this *PolyManager) handleDepositEvents(height uint32) bool {
-	lastEpoch := this.findLatestHeight()
-	hdr, err := this.polySdk.GetHeaderByHeight(height + 1)
-	if err != nil {
-		log.Errorf("handleDepositEvents - GetNodeHeader on height :%d failed", height)
-		return false
-	}
-	isCurr := lastEpoch < height+1
-	isEpoch, pubkList, err := this.IsEpoch(hdr)
-	if err != nil {
-		log.Errorf("falied to check isEpoch: %v", err)
-		return false
-	}
-	var (
-		anchor *polytypes.Header
-		hp     string
-	)
-	if !isCurr {
-		anchor, _ = this.polySdk.GetHeaderByHeight(lastEpoch + 1)
-		proof, _ := this.polySdk.GetMerkleProof(height+1, lastEpoch+1)
-		hp = proof.AuditPath
-	} else if isEpoch {
-		anchor, _ = this.polySdk.GetHeaderByHeight(height + 2)
-		proof, _ := this.polySdk.GetMerkleProof(height+1, height+2)
-		hp = proof.AuditPath
-	}
-
-	cnt := 0
-	events, err := this.polySdk.GetSmartContractEventByBlock(height)
-	for err != nil {
-		log.Errorf("handleDepositEvents - get block event at height:%d error: %s", height, err.Error())
-		return false
-	}
-	for _, event := range events {
-		for _, notify := range event.Notify {
-			if notify.ContractAddress == this.config.PolyConfig.EntranceContractAddress {
-				states := notify.States.([]interface{})
-				method, _ := states[0].(string)
-				if method != "makeProof" {
-					continue
-				}
-				if uint64(states[2].(float64)) != this.config.HecoConfig.SideChainId {
-					continue
-				}
-				proof, err := this.polySdk.GetCrossStatesProof(hdr.Height-1, states[5].(string))
-				if err != nil {
-					log.Errorf("handleDepositEvents - failed to get proof for key %s: %v", states[5].(string), err)
-					continue
-				}
-				auditpath, _ := hex.DecodeString(proof.AuditPath)
-				value, _, _, _ := tools.ParseAuditpath(auditpath)
-				param := &common2.ToMerkleValue{}
-				if err := param.Deserialization(common.NewZeroCopySource(value)); err != nil {
-					log.Errorf("handleDepositEvents - failed to deserialize MakeTxParam (value: %x, err: %v)", value, err)
-					continue
-				}
-				if !METHODS[param.MakeTxParam.Method] {
-					log.Errorf("Invalid target contract method %s %s", param.MakeTxParam.Method, event.TxHash)
-					continue
-				}
-				var isTarget bool
-				if len(this.config.TargetContracts) > 0 {
-					toContractStr := ethcommon.BytesToAddress(param.MakeTxParam.ToContractAddress).String()
-					for _, v := range this.config.TargetContracts {
-						toChainIdArr, ok := v[toContractStr]
-						if ok {
-							if len(toChainIdArr["inbound"]) == 0 {
-								isTarget = true
-								break
-							}
-							for _, id := range toChainIdArr["inbound"] {
-								if id == param.FromChainID {
-									isTarget = true
-									break
-								}
-							}
-							if isTarget {
-								break
-							}
-						}
-					}
-					if !isTarget {
-						continue
-					}
-				}
-				cnt++
-				//sender := this.selectSender()
-				//log.Infof("sender %s is handling poly tx ( hash: %s, height: %d )",
-				//	sender.acc.Address.String(), event.TxHash, height)
-				//// temporarily ignore the error for tx
-				//sender.commitDepositEventsWithHeader(hdr, param, hp, anchor, event.TxHash, auditpath)
-				bridgeTransaction := &BridgeTransaction{
-					header:       hdr,
-					param:        param,
-					headerProof:  hp,
-					anchorHeader: anchor,
-					polyTxHash:   event.TxHash,
-					rawAuditPath: auditpath,
-					hasPay:       FEE_NOCHECK,
-					fee:          "",
-				}
-				sink := common.NewZeroCopySink(nil)
-				bridgeTransaction.Serialization(sink)
-				this.db.PutBridgeTransactions(hex.EncodeToString(param.MakeTxParam.TxHash), sink.Bytes())
-				//if !sender.commitDepositEventsWithHeader(hdr, param, hp, anchor, event.TxHash, auditpath) {
-				//	return false
-				//}
-			}
+// selectSender picks a sender for param with the configured selector out of
+// the senders with enough balance. It returns nil when no sender can relay.
+func (this *PolyManager) selectSender(param *common2.ToMerkleValue) *EthSender {
+	senders := make([]*EthSender, 0, len(this.senders))
+	for _, v := range this.senders {
+		if _, ok := v.cachedBalance(); ok {
+			senders = append(senders, v)
 		}
 	}
-	if cnt == 0 && isEpoch && isCurr && this.config.HecoConfig.EnableChangeBookKeeper {
-		sender := this.selectSender()
-		return sender.commitHeader(hdr, pubkList)
-	}
-
-	return true
-}
-
-func (this *PolyManager) selectSender() *EthSender {
-	sum := big.NewInt(0)
-	balArr := make([]*big.Int, len(this.senders))
-	for i, v := range this.senders {
-	RETRY:
-		bal, err := v.Balance()
-		if err != nil {
-			log.Errorf("failed to get balance for %s: %v", v.acc.Address.String(), err)
-			time.Sleep(time.Second)
-			goto RETRY
-		}
-		sum.Add(sum, bal)
-		balArr[i] = big.NewInt(sum.Int64())
-	}
-	sum.Rand(rand.New(rand.NewSource(time.Now().Unix())), sum)
-	for i, v := range balArr {
-		res := v.Cmp(sum)
-		if res == 1 || res == 0 {
-			return this.senders[i]
-		}
+	if len(senders) == 0 {
+		senderLog.Errorf("selectSender - no heco sender has enough balance")
+		return nil
 	}
-	return this.senders[0]
+	return this.selector.Select(senders, param)
 }
 
 func (this *PolyManager) MonitorDeposit() {
@@ -470,6 +426,10 @@ func (this *PolyManager) MonitorDeposit() {
 	for {
 		select {
 		case <-monitorTicker.C:
+			health.Beat(HEARTBEAT_MONITOR_POLY_DEPOSIT)
+			if chainsDegraded("MonitorDeposit", this.ethClient, nil) {
+				continue
+			}
 			this.handleLockDepositEvents()
 		case <-this.exitChan:
 			return
@@ -490,81 +450,94 @@ func (this *PolyManager) handleLockDepositEvents() error {
 		bridgeTransaction := new(BridgeTransaction)
 		err := bridgeTransaction.Deserialization(common.NewZeroCopySource(v))
 		if err != nil {
-			log.Errorf("handleLockDepositEvents - retry.Deserialization error: %s", err)
+			feeLog.Errorf("handleLockDepositEvents - retry.Deserialization error: %s", err)
 			continue
 		}
 		bridgeTransactions[k] = bridgeTransaction
 	}
-	noCheckFees := make([]*poly_bridge_sdk.CheckFeeReq, 0)
+	now := time.Now().Unix()
+	noCheckFees := make([]*FeeCheckReq, 0)
 	for k, v := range bridgeTransactions {
-		if v.hasPay == FEE_NOCHECK {
-			noCheckFees = append(noCheckFees, &poly_bridge_sdk.CheckFeeReq{
-				ChainId: v.param.FromChainID,
-				Hash:    k,
+		if v.hasPay == FEE_NOCHECK || (v.hasPay == FEE_PENDING_RECHECK && v.nextCheck <= now) {
+			noCheckFees = append(noCheckFees, &FeeCheckReq{
+				CheckFeeReq: poly_bridge_sdk.CheckFeeReq{
+					ChainId: v.param.FromChainID,
+					Hash:    k,
+				},
+				FromContract: hex.EncodeToString(v.param.MakeTxParam.FromContractAddress),
 			})
 		}
 	}
 	if len(noCheckFees) > 0 {
 		checkFees, err := this.checkFee(noCheckFees)
 		if err != nil {
-			log.Errorf("handleLockDepositEvents - checkFee error: %s", err)
+			feeLog.Errorf("handleLockDepositEvents - checkFee error: %s", err)
 		}
 		if checkFees != nil {
 			for _, checkFee := range checkFees {
 				if checkFee.Error != "" {
-					log.Errorf("check fee err: %s", checkFee.Error)
+					feeLog.Errorf("check fee err: %s", checkFee.Error)
 					continue
 				}
-				//checkFee.PayState = FEE_NOTPAY
 				item, ok := bridgeTransactions[checkFee.Hash]
 				if ok {
-					if checkFee.PayState == poly_bridge_sdk.STATE_HASPAY {
-						log.Infof("tx(%d,%s) has payed fee", checkFee.ChainId, checkFee.Hash)
+					if checkFee.PayState == poly_bridge_sdk.STATE_HASPAY && checkFee.Unchecked {
+						item.logger(feeLog).Infof("tx(%d,%s) is relayed without fee check", checkFee.ChainId, checkFee.Hash)
+						item.hasPay = FEE_UNCHECKED
+						item.fee = checkFee.Amount
+						item.dropReason = ""
+					} else if checkFee.PayState == poly_bridge_sdk.STATE_HASPAY {
+						item.logger(feeLog).Infof("tx(%d,%s) has payed fee", checkFee.ChainId, checkFee.Hash)
 						item.hasPay = FEE_HASPAY
 						item.fee = checkFee.Amount
+						item.dropReason = ""
 					} else if checkFee.PayState == poly_bridge_sdk.STATE_NOTPAY {
-						log.Infof("tx(%d,%s) has not payed fee", checkFee.ChainId, checkFee.Hash)
-						item.hasPay = FEE_NOTPAY
+						item.logger(feeLog).Infof("tx(%d,%s) has not payed fee", checkFee.ChainId, checkFee.Hash)
+						this.recheckFee(item, "fee not paid", now)
 					} else if checkFee.PayState == poly_bridge_sdk.STATE_NOTPOLYPROXY {
-						log.Infof("tx(%d,%s) has not POLYPROXY", checkFee.ChainId, checkFee.Hash)
-						item.hasPay = FEE_NOTPAY
+						item.logger(feeLog).Infof("tx(%d,%s) has not POLYPROXY", checkFee.ChainId, checkFee.Hash)
+						this.recheckFee(item, "not sent through poly proxy", now)
 					} else {
-						log.Errorf("check fee of tx(%d,%s) failed", checkFee.ChainId, checkFee.Hash)
+						item.logger(feeLog).Errorf("check fee of tx(%d,%s) failed", checkFee.ChainId, checkFee.Hash)
 					}
 				}
 			}
 		}
 	}
 	for k, v := range bridgeTransactions {
-		if v.hasPay == FEE_NOTPAY {
-			this.db.DeleteBridgeTransactions(k)
-			log.Infof("tx (src %d, %s, poly %s) has not pay proxy fee, ignore it, payed: %s",
-				v.param.FromChainID, hex.EncodeToString(v.param.MakeTxParam.TxHash), v.polyTxHash, v.fee)
+		if v.hasPay == FEE_EXPIRED {
+			v.logger(feeLog).Infof("tx (src %d, %s, poly %s) has not pay proxy fee, ignore it, reason: %s",
+				v.param.FromChainID, hex.EncodeToString(v.param.MakeTxParam.TxHash), v.polyTxHash, v.dropReason)
+			this.deadLetter(k, v)
 			delete(bridgeTransactions, k)
 		}
 	}
-	var maxFeeOfTransaction *BridgeTransaction = nil
-	maxFee := new(big.Float).SetUint64(0)
-	maxFeeOfTxHash := ""
-	for k, v := range bridgeTransactions {
-		fee, ok := new(big.Float).SetString(v.fee)
-		if ok != true {
-			continue
-		}
-		if v.hasPay == FEE_HASPAY || fee.Cmp(maxFee) > 0 {
-			maxFee = fee
-			maxFeeOfTransaction = v
-			maxFeeOfTxHash = k
+	for _, item := range this.scheduleRelays(bridgeTransactions) {
+		sender := this.selectSender(item.tx.param)
+		if sender == nil {
+			senderLog.Errorf("handleLockDepositEvents - no sender available")
+			break
 		}
-	}
-	if maxFeeOfTransaction != nil {
-		sender := this.selectSender()
-		log.Infof("sender %s is handling poly tx ( hash: %x)", sender.acc.Address.String(), maxFeeOfTransaction.param.TxHash)
-		res := sender.commitDepositEventsWithHeader(maxFeeOfTransaction.header, maxFeeOfTransaction.param, maxFeeOfTransaction.headerProof,
-			maxFeeOfTransaction.anchorHeader, hex.EncodeToString(maxFeeOfTransaction.param.TxHash), maxFeeOfTransaction.rawAuditPath)
-		if res == true {
-			this.db.DeleteBridgeTransactions(maxFeeOfTxHash)
-			delete(bridgeTransactions, maxFeeOfTxHash)
+		item.tx.logger(senderLog).Infof("sender %s is handling poly tx ( hash: %x, fee: %s, score: %s )", sender.acc.Address.String(), item.tx.param.TxHash,
+			item.tx.fee, item.score.Text('f', 6))
+		res := sender.commitDepositEventsWithHeader(item.tx.header, item.tx.param, item.tx.headerProof,
+			item.tx.anchorHeader, hex.EncodeToString(item.tx.param.TxHash), item.tx.rawAuditPath, item.tx.fee, item.tx.hasPay == FEE_HASPAY)
+		switch res {
+		case COMMIT_DONE:
+			this.db.DeleteBridgeTransactions(item.hash)
+			delete(bridgeTransactions, item.hash)
+			delete(this.deferred, item.hash)
+		case COMMIT_DEFERRED:
+			if now-item.tx.createTime > this.profit.maxDeferTime() {
+				item.tx.dropReason = "fee does not cover the gas"
+				item.tx.logger(feeLog).Warnf("tx (src %d, %s, poly %s) is not profitable for too long, ignore it, payed: %s",
+					item.tx.param.FromChainID, hex.EncodeToString(item.tx.param.MakeTxParam.TxHash), item.tx.polyTxHash, item.tx.fee)
+				this.deadLetter(item.hash, item.tx)
+				delete(bridgeTransactions, item.hash)
+				delete(this.deferred, item.hash)
+			} else {
+				this.deferred[item.hash] = now + this.profit.recheckInterval()
+			}
 		}
 	}
 	for k, v := range bridgeTransactions {
@@ -575,8 +548,44 @@ func (this *PolyManager) handleLockDepositEvents() error {
 	return nil
 }
 
-func (this *PolyManager) checkFee(checks []*poly_bridge_sdk.CheckFeeReq) ([]*poly_bridge_sdk.CheckFeeRsp, error) {
-	return this.bridgeSdk.CheckFee(checks)
+// recheckFee schedules another fee check of tx, or expires it when its fee
+// has not been found paid for FeeRecheckExpiry
+func (this *PolyManager) recheckFee(tx *BridgeTransaction, reason string, now int64) {
+	expiry := this.config.FeeRecheckExpiry
+	if expiry == 0 {
+		expiry = config.DEFAULT_FEE_RECHECK_EXPIRY
+	}
+	interval := this.config.FeeRecheckInterval
+	if interval == 0 {
+		interval = config.DEFAULT_FEE_RECHECK_INTERVAL
+	}
+	if now-tx.createTime >= expiry {
+		tx.hasPay = FEE_EXPIRED
+		tx.dropReason = fmt.Sprintf("%s after checking for %ds", reason, now-tx.createTime)
+		return
+	}
+	tx.hasPay = FEE_PENDING_RECHECK
+	tx.nextCheck = now + interval
+	tx.dropReason = reason
+}
+
+// deadLetter moves a tx that will not be relayed out of the bridge
+// transactions, its dropReason tells why
+func (this *PolyManager) deadLetter(k string, tx *BridgeTransaction) {
+	sink := common.NewZeroCopySink(nil)
+	tx.Serialization(sink)
+	if err := this.db.PutDeadLetter(k, sink.Bytes()); err != nil {
+		feeLog.Errorf("deadLetter - failed to put tx %s: %v", k, err)
+		return
+	}
+	this.db.DeleteBridgeTransactions(k)
+	update := tx.transferUpdate(db.TRANSFER_DROPPED)
+	update.Desc = tx.dropReason
+	trackTransfer(this.db, tx.logger(feeLog), update)
+}
+
+func (this *PolyManager) checkFee(checks []*FeeCheckReq) ([]*FeeCheckRsp, error) {
+	return this.feeChecker.CheckFee(checks)
 }
 
 func (this *PolyManager) Stop() {
@@ -587,49 +596,79 @@ func (this *PolyManager) Stop() {
 
 type EthSender struct {
 	acc          accounts.Account
+	balance      *big.Int
+	lowBalance   bool
+	pending      int64 // txs handed to the send routines and not confirmed yet
+	lock         sync.Mutex
 	keyStore     *tools.HecoKeyStore
-	cmap         map[string]chan *EthTxInfo
+	queue        *senderQueue
+	profit       *ProfitGate
 	nonceManager *tools.NonceManager
-	ethClient    *ethclient.Client
-	polySdk      *sdk.PolySdk
+	ethClient    *tools.HecoClient
+	polySdk      *tools.PolyClient
 	config       *config.ServiceConfig
 	contractAbi  *abi.ABI
+	eccd         *eccd_abi.EthCrossChainData // shared by all senders
 }
 
-func (this *EthSender) sendTxToEth(info *EthTxInfo) error {
-	nonce := this.nonceManager.GetAddressNonce(this.acc.Address)
-	tx := types.NewTransaction(nonce, info.contractAddr, big.NewInt(0), info.gasLimit, info.gasPrice, info.txData)
-	signedtx, err := this.keyStore.SignTransaction(tx, this.acc)
-	if err != nil {
-		this.nonceManager.ReturnNonce(this.acc.Address, nonce)
-		return fmt.Errorf("commitDepositEventsWithHeader - sign raw tx error and return nonce %d: %v", nonce, err)
-	}
-
-	for {
-		err = this.ethClient.SendTransaction(context.Background(), signedtx)
-		if err != nil {
-			log.Errorf("poly to heco SendTransaction error: %v, nonce %d", err, nonce)
+// sendTxToEth signs info with the next nonce of the sender and sends it to
+// heco. A tx the node already knows counts as sent and nonce errors resync
+// the nonce before signing again. Other errors are retried up to
+// MAX_SEND_TX_RETRIES times, or not at all when retrying can't help.
+func (this *EthSender) sendTxToEth(info *EthTxInfo) (ethcommon.Hash, uint64, error) {
+	var sendErr error
+	for i := 0; i < MAX_SEND_TX_RETRIES; i++ {
+		if i > 0 {
 			time.Sleep(time.Second)
+		}
+		nonce := this.nonceManager.GetAddressNonce(this.acc.Address)
+		tx := types.NewTransaction(nonce, info.contractAddr, big.NewInt(0), info.gasLimit, info.gasPrice, info.txData)
+		signedtx, err := this.keyStore.SignTransaction(tx, this.acc)
+		if err != nil {
+			this.nonceManager.ReturnNonce(this.acc.Address, nonce)
+			return ethcommon.Hash{}, 0, fmt.Errorf("sendTxToEth - sign raw tx error and return nonce %d: %v", nonce, err)
+		}
+		sendErr = this.ethClient.SendTransaction(context.Background(), signedtx)
+		if sendErr == nil || isKnownTxError(sendErr) {
+			return signedtx.Hash(), nonce, nil
+		}
+		senderLog.Errorf("poly to heco SendTransaction error: %v, nonce %d", sendErr, nonce)
+		if isNonceError(sendErr) {
+			if err := this.nonceManager.ResyncAddressNonce(this.acc.Address); err != nil {
+				senderLog.Errorf("sendTxToEth - failed to resync nonce of %s: %v", this.acc.Address.String(), err)
+			}
 			continue
 		}
-		hash := signedtx.Hash()
-
-		isSuccess := this.waitTransactionConfirm(info.polyTxHash, hash)
-		if isSuccess {
-			log.Infof("successful to relay tx to huobi_eco: (heco_hash: %s, nonce: %d, poly_hash: %s, heco_explorer: %s)",
-				hash.String(), nonce, info.polyTxHash, tools.GetExplorerUrl(this.keyStore.GetChainId())+hash.String())
-			return nil
+		// the same nonce signs the same tx again, so a retry of a tx that
+		// did reach the node is reported as already known
+		this.nonceManager.ReturnNonce(this.acc.Address, nonce)
+		if isPermanentSendError(sendErr) {
+			return ethcommon.Hash{}, 0, fmt.Errorf("sendTxToEth - tx rejected by heco: %v", sendErr)
 		}
+	}
+	return ethcommon.Hash{}, 0, fmt.Errorf("sendTxToEth - failed after %d attempts: %v", MAX_SEND_TX_RETRIES, sendErr)
+}
 
-		log.Errorf("failed to relay tx to huobi_eco: (heco_hash: %s, nonce: %d, poly_hash: %s, heco_explorer: %s)",
-			hash.String(), nonce, info.polyTxHash, tools.GetExplorerUrl(this.keyStore.GetChainId())+hash.String())
+func isKnownTxError(err error) bool {
+	desc := err.Error()
+	return strings.Contains(desc, "already known") || strings.Contains(desc, "known transaction")
+}
 
-		return nil
-	}
+func isNonceError(err error) bool {
+	desc := err.Error()
+	return strings.Contains(desc, "nonce too low") || strings.Contains(desc, "replacement transaction underpriced")
+}
 
+func isPermanentSendError(err error) bool {
+	desc := err.Error()
+	return strings.Contains(desc, "insufficient funds") || strings.Contains(desc, "intrinsic gas too low") ||
+		strings.Contains(desc, "exceeds block gas limit")
 }
 
-func (this *EthSender) commitDepositEventsWithHeader(header *polytypes.Header, param *common2.ToMerkleValue, headerProof string, anchorHeader *polytypes.Header, polyTxHash string, rawAuditPath []byte) bool {
+// commitDepositEventsWithHeader queues the tx relaying param to heco, fee is
+// the amount paid for it and checked against the gas when profit gate is on
+func (this *EthSender) commitDepositEventsWithHeader(header *polytypes.Header, param *common2.ToMerkleValue, headerProof string, anchorHeader *polytypes.Header, polyTxHash string, rawAuditPath []byte, fee string, checkProfit bool) int {
+	logger := senderLog.With(log.CorrelationID(param.FromChainID, param.MakeTxParam.CrossChainID), log.String("poly_tx", polyTxHash))
 	var (
 		sigs       []byte
 		headerData []byte
@@ -650,20 +689,21 @@ func (this *EthSender) commitDepositEventsWithHeader(header *polytypes.Header, p
 		}
 	}
 
-	eccdAddr := ethcommon.HexToAddress(this.config.HecoConfig.ECCDContractAddress)
-	eccd, err := eccd_abi.NewEthCrossChainData(eccdAddr, this.ethClient)
-	if err != nil {
-		panic(fmt.Errorf("failed to new eccm: %v", err))
-	}
 	fromTx := [32]byte{}
 	copy(fromTx[:], param.TxHash[:32])
-	res, _ := eccd.CheckIfFromChainTxExist(nil, param.FromChainID, fromTx)
+	res, _ := this.eccd.CheckIfFromChainTxExist(nil, param.FromChainID, fromTx)
 	if res {
-		log.Debugf("already relayed to heco: ( from_chain_id: %d, from_txhash: %x,  param.Txhash: %x)",
+		logger.Debugf("already relayed to heco: ( from_chain_id: %d, from_txhash: %x,  param.Txhash: %x)",
 			param.FromChainID, param.TxHash, param.MakeTxParam.TxHash)
-		return true
+		trackTransfer(this.queue.db, logger, &db.TransferUpdate{
+			FromChainId:  param.FromChainID,
+			CrossChainId: param.MakeTxParam.CrossChainID,
+			State:        db.TRANSFER_HECO_CONFIRMED,
+			Desc:         "already relayed to heco",
+		})
+		return COMMIT_DONE
 	}
-	//log.Infof("poly proof with header, height: %d, key: %s, proof: %s", header.Height-1, string(key), proof.AuditPath)
+	//logger.Infof("poly proof with header, height: %d, key: %s, proof: %s", header.Height-1, string(key), proof.AuditPath)
 
 	rawProof, _ := hex.DecodeString(headerProof)
 	var rawAnchor []byte
@@ -673,14 +713,14 @@ func (this *EthSender) commitDepositEventsWithHeader(header *polytypes.Header, p
 	headerData = header.GetMessage()
 	txData, err := this.contractAbi.Pack("verifyHeaderAndExecuteTx", rawAuditPath, headerData, rawProof, rawAnchor, sigs)
 	if err != nil {
-		log.Errorf("commitDepositEventsWithHeader - err:" + err.Error())
-		return false
+		logger.Errorf("commitDepositEventsWithHeader - err:" + err.Error())
+		return COMMIT_RETRY
 	}
 
 	gasPrice, err := this.ethClient.SuggestGasPrice(context.Background())
 	if err != nil {
-		log.Errorf("commitDepositEventsWithHeader - get suggest sas price failed error: %s", err.Error())
-		return false
+		logger.Errorf("commitDepositEventsWithHeader - get suggest sas price failed error: %s", err.Error())
+		return COMMIT_RETRY
 	}
 	contractaddr := ethcommon.HexToAddress(this.config.HecoConfig.ECCMContractAddress)
 	callMsg := ethereum.CallMsg{
@@ -689,39 +729,52 @@ func (this *EthSender) commitDepositEventsWithHeader(header *polytypes.Header, p
 	}
 	gasLimit, err := this.ethClient.EstimateGas(context.Background(), callMsg)
 	if err != nil {
-		log.Errorf("commitDepositEventsWithHeader - estimate gas limit error: %s", err.Error())
-		return false
+		logger.Errorf("commitDepositEventsWithHeader - estimate gas limit error: %s", err.Error())
+		return COMMIT_RETRY
 	}
 
 	// Check gas limit
 	gasLimit = uint64(float32(gasLimit) * 1.1)
 	if e := CheckGasLimit(polyTxHash, gasLimit); e != nil {
-		log.Errorf("Skipped poly tx %s for gas limit too high %v", polyTxHash, gasLimit)
-		return true
+		logger.Errorf("Skipped poly tx %s for gas limit too high %v", polyTxHash, gasLimit)
+		trackTransfer(this.queue.db, logger, &db.TransferUpdate{
+			FromChainId:  param.FromChainID,
+			CrossChainId: param.MakeTxParam.CrossChainID,
+			State:        db.TRANSFER_DROPPED,
+			Desc:         fmt.Sprintf("gas limit %d too high", gasLimit),
+		})
+		return COMMIT_DONE
+	}
+
+	if this.profit != nil && checkProfit {
+		profitable, desc, err := this.profit.check(fee, gasLimit, gasPrice)
+		if err != nil {
+			logger.Errorf("commitDepositEventsWithHeader - failed to check profit of poly tx %s: %v", polyTxHash, err)
+			return COMMIT_RETRY
+		}
+		if !profitable {
+			logger.Warnf("commitDepositEventsWithHeader - poly tx %s is not profitable: %s", polyTxHash, desc)
+			return COMMIT_DEFERRED
+		}
 	}
 
-	k := this.getRouter()
-	c, ok := this.cmap[k]
-	if !ok {
-		c = make(chan *EthTxInfo, ChanLen)
-		this.cmap[k] = c
-		go func() {
-			for v := range c {
-				if err = this.sendTxToEth(v); err != nil {
-					log.Errorf("failed to send tx to heco: error: %v, txData: %s", err, hex.EncodeToString(v.txData))
-				}
-			}
-		}()
-	}
-	//TODO: could be blocked
-	c <- &EthTxInfo{
+	err = this.queue.push(&EthTxInfo{
 		txData:       txData,
 		contractAddr: contractaddr,
 		gasPrice:     gasPrice,
 		gasLimit:     gasLimit,
 		polyTxHash:   polyTxHash,
+		fromChainId:  param.FromChainID,
+		fromTxHash:   param.TxHash,
+		crossChainId: param.MakeTxParam.CrossChainID,
+		fee:          fee,
+		checkProfit:  checkProfit,
+	})
+	if err != nil {
+		logger.Errorf("commitDepositEventsWithHeader - failed to queue poly tx %s: %v", polyTxHash, err)
+		return COMMIT_RETRY
 	}
-	return true
+	return COMMIT_DONE
 }
 
 func (this *EthSender) commitHeader(header *polytypes.Header, pubkList []byte) bool {
@@ -733,7 +786,7 @@ func (this *EthSender) commitHeader(header *polytypes.Header, pubkList []byte) b
 	)
 	gasPrice, err := this.ethClient.SuggestGasPrice(context.Background())
 	if err != nil {
-		log.Errorf("commitHeader - get suggest sas price failed error: %s", err.Error())
+		senderLog.Errorf("commitHeader - get suggest sas price failed error: %s", err.Error())
 		return false
 	}
 	for _, sig := range header.SigData {
@@ -745,7 +798,7 @@ func (this *EthSender) commitHeader(header *polytypes.Header, pubkList []byte) b
 
 	txData, txErr = this.contractAbi.Pack("changeBookKeeper", headerdata, pubkList, sigs)
 	if txErr != nil {
-		log.Errorf("commitHeader - err:" + err.Error())
+		senderLog.Errorf("commitHeader - err:" + txErr.Error())
 		return false
 	}
 
@@ -757,7 +810,7 @@ func (this *EthSender) commitHeader(header *polytypes.Header, pubkList []byte) b
 
 	gasLimit, err := this.ethClient.EstimateGas(context.Background(), callMsg)
 	if err != nil {
-		log.Errorf("commitHeader - estimate gas limit error: %s", err.Error())
+		senderLog.Errorf("commitHeader - estimate gas limit error: %s", err.Error())
 		return false
 	}
 
@@ -765,11 +818,11 @@ func (this *EthSender) commitHeader(header *polytypes.Header, pubkList []byte) b
 	tx := types.NewTransaction(nonce, contractaddr, big.NewInt(0), gasLimit, gasPrice, txData)
 	signedtx, err := this.keyStore.SignTransaction(tx, this.acc)
 	if err != nil {
-		log.Errorf("commitHeader - sign raw tx error: %s", err.Error())
+		senderLog.Errorf("commitHeader - sign raw tx error: %s", err.Error())
 		return false
 	}
 	if err = this.ethClient.SendTransaction(context.Background(), signedtx); err != nil {
-		log.Errorf("commitHeader - send transaction error:%s\n", err.Error())
+		senderLog.Errorf("commitHeader - send transaction error:%s\n", err.Error())
 		return false
 	}
 
@@ -777,17 +830,34 @@ func (this *EthSender) commitHeader(header *polytypes.Header, pubkList []byte) b
 	txhash := signedtx.Hash()
 	isSuccess := this.waitTransactionConfirm(fmt.Sprintf("header: %d", header.Height), txhash)
 	if isSuccess {
-		log.Infof("successful to relay poly header to heco: (header_hash: %s, height: %d, heco_txhash: %s, nonce: %d, heco_explorer: %s)",
+		senderLog.Infof("successful to relay poly header to heco: (header_hash: %s, height: %d, heco_txhash: %s, nonce: %d, heco_explorer: %s)",
 			hash.ToHexString(), header.Height, txhash.String(), nonce, tools.GetExplorerUrl(this.keyStore.GetChainId())+txhash.String())
 	} else {
-		log.Errorf("failed to relay poly header to heco: (header_hash: %s, height: %d, heco_txhash: %s, nonce: %d, heco_explorer: %s)",
+		senderLog.Errorf("failed to relay poly header to heco: (header_hash: %s, height: %d, heco_txhash: %s, nonce: %d, heco_explorer: %s)",
 			hash.ToHexString(), header.Height, txhash.String(), nonce, tools.GetExplorerUrl(this.keyStore.GetChainId())+txhash.String())
+		notify.Notify(&notify.Event{
+			Kind:    notify.EVENT_RELAY_FAILED,
+			Subject: hash.ToHexString(),
+			Message: fmt.Sprintf("failed to relay poly header %d to heco", header.Height),
+			Fields:  map[string]string{"heco_tx": txhash.String(), "sender": this.acc.Address.String()},
+		})
+	}
+	return isSuccess
+}
+
+// cachedBalance returns the balance of the last check and false when the
+// sender is excluded for low balance or its balance is still unknown
+func (this *EthSender) cachedBalance() (*big.Int, bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.balance == nil || this.lowBalance {
+		return nil, false
 	}
-	return true
+	return this.balance, true
 }
 
-func (this *EthSender) getRouter() string {
-	return strconv.FormatInt(rand.Int63n(this.config.RoutineNum), 10)
+func (this *EthSender) Pending() int64 {
+	return atomic.LoadInt64(&this.pending)
 }
 
 func (this *EthSender) Balance() (*big.Int, error) {
@@ -810,7 +880,7 @@ func (this *EthSender) waitTransactionConfirm(polyTxHash string, hash ethcommon.
 		if err != nil {
 			continue
 		}
-		log.Debugf("( heco_transaction %s, poly_tx %s ) is pending: %v", hash.String(), polyTxHash, ispending)
+		senderLog.Debugf("( heco_transaction %s, poly_tx %s ) is pending: %v", hash.String(), polyTxHash, ispending)
 		if ispending == true {
 			continue
 		} else {
@@ -829,4 +899,104 @@ type EthTxInfo struct {
 	gasPrice     *big.Int
 	contractAddr ethcommon.Address
 	polyTxHash   string
+	fromChainId  uint64
+	fromTxHash   []byte
+	crossChainId []byte
+	fee          string // fee paid for the tx, checked again when raising the gas price
+	checkProfit  bool
+	sentHash     ethcommon.Hash // set once sent, a restart waits for it instead of sending again
+	sentNonce    uint64
+}
+
+func (this *EthTxInfo) logger() *log.Entry {
+	return senderLog.With(log.CorrelationID(this.fromChainId, this.crossChainId), log.String("poly_tx", this.polyTxHash))
+}
+
+// transferUpdate moves the transfer of info to state, hash is the heco tx if any
+func (this *EthTxInfo) transferUpdate(state db.TransferState, hash string, desc string) *db.TransferUpdate {
+	return &db.TransferUpdate{
+		FromChainId:  this.fromChainId,
+		CrossChainId: this.crossChainId,
+		DstTxHash:    hash,
+		State:        state,
+		Desc:         desc,
+	}
+}
+
+// notifyFailure alerts that relaying info to heco by sender failed, hash is the heco tx if any
+func (this *EthTxInfo) notifyFailure(sender *EthSender, hash string, reason string) {
+	notify.Notify(&notify.Event{
+		Kind:    notify.EVENT_RELAY_FAILED,
+		Subject: this.polyTxHash,
+		Message: fmt.Sprintf("failed to relay poly tx %s to heco: %s", this.polyTxHash, reason),
+		Fields: map[string]string{
+			"cid":     fmt.Sprintf("%d-%x", this.fromChainId, this.crossChainId),
+			"poly_tx": this.polyTxHash,
+			"heco_tx": hash,
+			"sender":  sender.acc.Address.String(),
+		},
+	})
+}
+
+func (this *EthTxInfo) Serialization(sink *common.ZeroCopySink) {
+	sink.WriteVarBytes(this.txData)
+	sink.WriteUint64(this.gasLimit)
+	sink.WriteVarBytes(this.gasPrice.Bytes())
+	sink.WriteVarBytes(this.contractAddr.Bytes())
+	sink.WriteString(this.polyTxHash)
+	sink.WriteUint64(this.fromChainId)
+	sink.WriteVarBytes(this.fromTxHash)
+	sink.WriteVarBytes(this.crossChainId)
+	sink.WriteString(this.fee)
+	sink.WriteBool(this.checkProfit)
+	if this.sentHash != (ethcommon.Hash{}) {
+		sink.WriteVarBytes(this.sentHash.Bytes())
+	} else {
+		sink.WriteVarBytes(nil)
+	}
+	sink.WriteUint64(this.sentNonce)
+}
+
+func (this *EthTxInfo) Deserialization(source *common.ZeroCopySource) error {
+	var eof bool
+	this.txData, eof = source.NextVarBytes()
+	if eof {
+		return fmt.Errorf("Waiting deserialize tx data error")
+	}
+	this.gasLimit, eof = source.NextUint64()
+	if eof {
+		return fmt.Errorf("Waiting deserialize gas limit error")
+	}
+	gasPrice, eof := source.NextVarBytes()
+	if eof {
+		return fmt.Errorf("Waiting deserialize gas price error")
+	}
+	this.gasPrice = new(big.Int).SetBytes(gasPrice)
+	contractAddr, eof := source.NextVarBytes()
+	if eof {
+		return fmt.Errorf("Waiting deserialize contract address error")
+	}
+	this.contractAddr = ethcommon.BytesToAddress(contractAddr)
+	this.polyTxHash, eof = source.NextString()
+	if eof {
+		return fmt.Errorf("Waiting deserialize poly tx hash error")
+	}
+	this.fromChainId, eof = source.NextUint64()
+	if eof {
+		return fmt.Errorf("Waiting deserialize from chain id error")
+	}
+	this.fromTxHash, eof = source.NextVarBytes()
+	if eof {
+		return fmt.Errorf("Waiting deserialize from tx hash error")
+	}
+	// queued before the cross chain id was kept
+	this.crossChainId, _ = source.NextVarBytes()
+	// queued before the fee and the sent tx were kept
+	this.fee, _ = source.NextString()
+	this.checkProfit, _ = source.NextBool()
+	if sentHash, _ := source.NextVarBytes(); len(sentHash) != 0 {
+		this.sentHash = ethcommon.BytesToHash(sentHash)
+	}
+	this.sentNonce, _ = source.NextUint64()
+	return nil
 }
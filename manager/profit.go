@@ -0,0 +1,82 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package manager
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/polynetwork/heco_relayer/config"
+	"github.com/polynetwork/heco_relayer/tools"
+)
+
+// ProfitGate checks that the fee paid for a tx covers the gas of relaying it
+type ProfitGate struct {
+	cfg   *config.ProfitConfig
+	price tools.PriceSource
+}
+
+// NewProfitGate returns nil when cfg is nil, relaying every paid tx
+func NewProfitGate(cfg *config.ProfitConfig) (*ProfitGate, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	this := &ProfitGate{cfg: cfg}
+	if cfg.PriceUrl != "" {
+		this.price = tools.NewHTTPPrice(cfg.PriceUrl, cfg.PricePath)
+	} else {
+		price, err := tools.NewStaticPrice(cfg.HTPrice)
+		if err != nil {
+			return nil, fmt.Errorf("NewProfitGate - %v", err)
+		}
+		this.price = price
+	}
+	return this, nil
+}
+
+// check tells if fee covers gasLimit * gasPrice by the configured margin,
+// the error is only set when the cost could not be calculated
+func (this *ProfitGate) check(fee string, gasLimit uint64, gasPrice *big.Int) (bool, string, error) {
+	paid, ok := new(big.Float).SetString(fee)
+	if !ok {
+		return false, "", fmt.Errorf("invalid fee %s", fee)
+	}
+	price, err := this.price.Price()
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get HT price: %v", err)
+	}
+	wei := new(big.Int).Mul(new(big.Int).SetUint64(gasLimit), gasPrice)
+	cost := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e18))
+	cost.Mul(cost, price)
+	required := new(big.Float).Mul(cost, big.NewFloat(1+this.cfg.Margin))
+	desc := fmt.Sprintf("fee %s, cost %s, required %s", paid.Text('f', 6), cost.Text('f', 6), required.Text('f', 6))
+	return paid.Cmp(required) >= 0, desc, nil
+}
+
+func (this *ProfitGate) recheckInterval() int64 {
+	if this == nil || this.cfg.RecheckInterval == 0 {
+		return config.DEFAULT_PROFIT_RECHECK_INTERVAL
+	}
+	return int64(this.cfg.RecheckInterval)
+}
+
+func (this *ProfitGate) maxDeferTime() int64 {
+	if this == nil || this.cfg.MaxDeferTime == 0 {
+		return config.DEFAULT_PROFIT_MAX_DEFER_TIME
+	}
+	return int64(this.cfg.MaxDeferTime)
+}
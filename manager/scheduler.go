@@ -0,0 +1,114 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package manager
+
+import (
+	"container/heap"
+	"math/big"
+	"strings"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/polynetwork/heco_relayer/config"
+)
+
+type relayItem struct {
+	hash  string
+	tx    *BridgeTransaction
+	score *big.Float
+}
+
+// relayQueue is a max heap of relay items by score, older txs first on ties
+type relayQueue []*relayItem
+
+func (q relayQueue) Len() int { return len(q) }
+
+func (q relayQueue) Less(i, j int) bool {
+	if res := q[i].score.Cmp(q[j].score); res != 0 {
+		return res > 0
+	}
+	return q[i].tx.createTime < q[j].tx.createTime
+}
+
+func (q relayQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *relayQueue) Push(x interface{}) { *q = append(*q, x.(*relayItem)) }
+
+func (q *relayQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// relayScore is the paid fee times the weight of the destination contract,
+// growing by FeeAgingUnit every FeeAgingPeriod the tx waits so cheap and
+// unpaid txs are not starved by a steady flow of better paying ones
+func (this *PolyManager) relayScore(tx *BridgeTransaction, now int64) (*big.Float, bool) {
+	fee, ok := new(big.Float).SetString(tx.fee)
+	if !ok {
+		return nil, false
+	}
+	cfg := this.config.HecoConfig
+	toContract := ethcommon.BytesToAddress(tx.param.MakeTxParam.ToContractAddress).String()
+	for k, w := range cfg.FeeWeights {
+		if strings.EqualFold(k, toContract) {
+			fee.Mul(fee, big.NewFloat(w))
+			break
+		}
+	}
+	period := cfg.FeeAgingPeriod
+	if period == 0 {
+		period = config.DEFAULT_FEE_AGING_PERIOD
+	}
+	unit := cfg.FeeAgingUnit
+	if unit == 0 {
+		unit = config.DEFAULT_FEE_AGING_UNIT
+	}
+	age := now - tx.createTime
+	if age < 0 {
+		age = 0
+	}
+	return fee.Add(fee, big.NewFloat(float64(age)/float64(period)*unit)), true
+}
+
+// scheduleRelays returns the paid txs to relay in this round, best score first
+func (this *PolyManager) scheduleRelays(txs map[string]*BridgeTransaction) []*relayItem {
+	now := time.Now().Unix()
+	q := make(relayQueue, 0, len(txs))
+	for k, v := range txs {
+		if v.hasPay != FEE_HASPAY && v.hasPay != FEE_UNCHECKED || this.deferred[k] > now {
+			continue
+		}
+		score, ok := this.relayScore(v, now)
+		if !ok {
+			continue
+		}
+		q = append(q, &relayItem{hash: k, tx: v, score: score})
+	}
+	heap.Init(&q)
+
+	num := this.config.HecoConfig.RelaysPerTick
+	if num <= 0 {
+		num = config.DEFAULT_RELAYS_PER_TICK
+	}
+	res := make([]*relayItem, 0, num)
+	for len(res) < num && q.Len() > 0 {
+		res = append(res, heap.Pop(&q).(*relayItem))
+	}
+	return res
+}
@@ -0,0 +1,213 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package manager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/polynetwork/heco_relayer/config"
+	"github.com/polynetwork/heco_relayer/db"
+	"github.com/polynetwork/heco_relayer/tools"
+	"github.com/polynetwork/poly/common"
+)
+
+type queuedTx struct {
+	seq  uint64
+	info *EthTxInfo
+}
+
+// senderQueue is the persistent, ordered queue of transactions of one sender.
+// A single routine signs and sends them so nonces follow the queue order,
+// confirmations are awaited concurrently for up to MaxInflightTxs txs.
+type senderQueue struct {
+	sender  *EthSender
+	db      *db.BoltDB
+	items   []*queuedTx
+	nextSeq uint64
+	notify  chan struct{}
+	slots   chan struct{}
+	lock    sync.Mutex
+}
+
+func newSenderQueue(sender *EthSender, boltDB *db.BoltDB) (*senderQueue, error) {
+	maxInflight := sender.config.HecoConfig.MaxInflightTxs
+	if maxInflight <= 0 {
+		maxInflight = config.DEFAULT_MAX_INFLIGHT_TXS
+	}
+	this := &senderQueue{
+		sender: sender,
+		db:     boltDB,
+		items:  make([]*queuedTx, 0),
+		notify: make(chan struct{}, 1),
+		slots:  make(chan struct{}, maxInflight),
+	}
+	stored, err := boltDB.GetSenderTxs(sender.acc.Address.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("newSenderQueue - failed to load queue of %s: %v", sender.acc.Address.String(), err)
+	}
+	for _, v := range stored {
+		info := new(EthTxInfo)
+		if err := info.Deserialization(common.NewZeroCopySource(v.Raw)); err != nil {
+			senderLog.Errorf("newSenderQueue - failed to deserialize tx %d of %s: %v", v.Seq, sender.acc.Address.String(), err)
+			boltDB.DeleteSenderTx(sender.acc.Address.Bytes(), v.Seq)
+			continue
+		}
+		this.items = append(this.items, &queuedTx{seq: v.Seq, info: info})
+		this.nextSeq = v.Seq + 1
+		atomic.AddInt64(&sender.pending, 1)
+	}
+	if len(this.items) > 0 {
+		senderLog.Infof("newSenderQueue - resume %d queued txs of %s", len(this.items), sender.acc.Address.String())
+		this.notify <- struct{}{}
+	}
+	go this.run()
+	return this, nil
+}
+
+// push persists info and appends it to the queue, it never blocks on sending
+func (this *senderQueue) push(info *EthTxInfo) error {
+	sink := common.NewZeroCopySink(nil)
+	info.Serialization(sink)
+
+	this.lock.Lock()
+	seq := this.nextSeq
+	if err := this.db.PutSenderTx(this.sender.acc.Address.Bytes(), seq, sink.Bytes()); err != nil {
+		this.lock.Unlock()
+		return err
+	}
+	this.nextSeq++
+	this.items = append(this.items, &queuedTx{seq: seq, info: info})
+	this.lock.Unlock()
+
+	atomic.AddInt64(&this.sender.pending, 1)
+	select {
+	case this.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (this *senderQueue) pop() *queuedTx {
+	for {
+		this.lock.Lock()
+		if len(this.items) > 0 {
+			tx := this.items[0]
+			this.items = this.items[1:]
+			this.lock.Unlock()
+			return tx
+		}
+		this.lock.Unlock()
+		<-this.notify
+	}
+}
+
+// update persists the changes made to tx while sending it
+func (this *senderQueue) update(tx *queuedTx) error {
+	sink := common.NewZeroCopySink(nil)
+	tx.info.Serialization(sink)
+	return this.db.PutSenderTx(this.sender.acc.Address.Bytes(), tx.seq, sink.Bytes())
+}
+
+func (this *senderQueue) done(tx *queuedTx) {
+	if err := this.db.DeleteSenderTx(this.sender.acc.Address.Bytes(), tx.seq); err != nil {
+		senderLog.Errorf("senderQueue - failed to delete tx %d of %s: %v", tx.seq, this.sender.acc.Address.String(), err)
+	}
+	atomic.AddInt64(&this.sender.pending, -1)
+}
+
+// relayed tells if the poly tx of info is already executed on heco, e.g. by
+// another relayer or before a restart
+func (this *senderQueue) relayed(info *EthTxInfo) bool {
+	fromTx := [32]byte{}
+	copy(fromTx[:], info.fromTxHash)
+	res, err := this.sender.eccd.CheckIfFromChainTxExist(nil, info.fromChainId, fromTx)
+	return err == nil && res
+}
+
+// bumpGasPrice raises the gas price of info to the suggested one, unless the
+// tx is no longer profitable at that price
+func (this *senderQueue) bumpGasPrice(info *EthTxInfo) {
+	gasPrice, err := this.sender.ethClient.SuggestGasPrice(context.Background())
+	if err != nil || gasPrice.Cmp(info.gasPrice) <= 0 {
+		return
+	}
+	if this.sender.profit != nil && info.checkProfit {
+		profitable, desc, err := this.sender.profit.check(info.fee, info.gasLimit, gasPrice)
+		if err != nil {
+			info.logger().Warnf("senderQueue - keep gas price %s, failed to check profit at %s: %v", info.gasPrice, gasPrice, err)
+			return
+		}
+		if !profitable {
+			info.logger().Warnf("senderQueue - keep gas price %s, not profitable at %s: %s", info.gasPrice, gasPrice, desc)
+			return
+		}
+	}
+	info.gasPrice = gasPrice
+}
+
+func (this *senderQueue) run() {
+	for {
+		tx := this.pop()
+		this.slots <- struct{}{}
+		if this.relayed(tx.info) {
+			tx.info.logger().Debugf("senderQueue - poly tx %s already relayed to heco, skip it", tx.info.polyTxHash)
+			trackTransfer(this.db, tx.info.logger(), tx.info.transferUpdate(db.TRANSFER_HECO_CONFIRMED, "", "already relayed to heco"))
+			this.done(tx)
+			<-this.slots
+			continue
+		}
+		hash, nonce := tx.info.sentHash, tx.info.sentNonce
+		if hash != (ethcommon.Hash{}) {
+			tx.info.logger().Infof("senderQueue - wait for heco tx %s (nonce: %d) sent before restart", hash.String(), nonce)
+		} else {
+			this.bumpGasPrice(tx.info)
+			var err error
+			hash, nonce, err = this.sender.sendTxToEth(tx.info)
+			if err != nil {
+				tx.info.logger().Errorf("failed to send tx to heco: error: %v, poly_hash: %s", err, tx.info.polyTxHash)
+				trackTransfer(this.db, tx.info.logger(), tx.info.transferUpdate(db.TRANSFER_DROPPED, "", err.Error()))
+				tx.info.notifyFailure(this.sender, "", err.Error())
+				this.done(tx)
+				<-this.slots
+				continue
+			}
+			tx.info.sentHash, tx.info.sentNonce = hash, nonce
+			if err := this.update(tx); err != nil {
+				tx.info.logger().Errorf("senderQueue - failed to keep heco tx %s of tx %d: %v", hash.String(), tx.seq, err)
+			}
+			trackTransfer(this.db, tx.info.logger(), tx.info.transferUpdate(db.TRANSFER_RELAYED, hash.String(), ""))
+		}
+		go func(tx *queuedTx) {
+			defer func() { <-this.slots }()
+			if this.sender.waitTransactionConfirm(tx.info.polyTxHash, hash) {
+				tx.info.logger().Infof("successful to relay tx to huobi_eco: (heco_hash: %s, nonce: %d, poly_hash: %s, heco_explorer: %s)",
+					hash.String(), nonce, tx.info.polyTxHash, tools.GetExplorerUrl(this.sender.keyStore.GetChainId())+hash.String())
+				trackTransfer(this.db, tx.info.logger(), tx.info.transferUpdate(db.TRANSFER_HECO_CONFIRMED, hash.String(), ""))
+			} else {
+				tx.info.logger().Errorf("failed to relay tx to huobi_eco: (heco_hash: %s, nonce: %d, poly_hash: %s, heco_explorer: %s)",
+					hash.String(), nonce, tx.info.polyTxHash, tools.GetExplorerUrl(this.sender.keyStore.GetChainId())+hash.String())
+				trackTransfer(this.db, tx.info.logger(), tx.info.transferUpdate(db.TRANSFER_DROPPED, hash.String(), "heco tx failed or not confirmed in 5 minutes"))
+				tx.info.notifyFailure(this.sender, hash.String(), "heco tx failed or not confirmed in 5 minutes")
+			}
+			this.done(tx)
+		}(tx)
+	}
+}
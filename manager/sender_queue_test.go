@@ -0,0 +1,63 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package manager
+
+import (
+	"math/big"
+	"testing"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/polynetwork/poly/common"
+)
+
+func TestEthTxInfoSentTx(t *testing.T) {
+	info := &EthTxInfo{
+		txData:       []byte{1, 2, 3},
+		gasLimit:     100000,
+		gasPrice:     big.NewInt(1000000000),
+		polyTxHash:   "0123",
+		fromChainId:  2,
+		fromTxHash:   []byte{4, 5},
+		crossChainId: []byte{6},
+		fee:          "1.5",
+		checkProfit:  true,
+		sentHash:     ethcommon.HexToHash("0xabcd"),
+		sentNonce:    7,
+	}
+	sink := common.NewZeroCopySink(nil)
+	info.Serialization(sink)
+	res := new(EthTxInfo)
+	if err := res.Deserialization(common.NewZeroCopySource(sink.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if res.fee != "1.5" || !res.checkProfit || res.sentHash != info.sentHash || res.sentNonce != 7 {
+		t.Fatalf("unexpected tx %+v", res)
+	}
+
+	// queued by an older version, before the fee and the sent tx were kept
+	info.fee, info.checkProfit, info.sentHash, info.sentNonce = "", false, ethcommon.Hash{}, 0
+	sink = common.NewZeroCopySink(nil)
+	info.Serialization(sink)
+	old := sink.Bytes()[:len(sink.Bytes())-11]
+	res = new(EthTxInfo)
+	if err := res.Deserialization(common.NewZeroCopySource(old)); err != nil {
+		t.Fatal(err)
+	}
+	if res.polyTxHash != "0123" || res.sentHash != (ethcommon.Hash{}) || res.checkProfit {
+		t.Fatalf("unexpected tx %+v", res)
+	}
+}
@@ -0,0 +1,141 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package manager
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	common2 "github.com/polynetwork/poly/native/service/cross_chain_manager/common"
+)
+
+const (
+	SELECTOR_BALANCE       = "balance"
+	SELECTOR_LEAST_PENDING = "least_pending"
+	SELECTOR_ROUND_ROBIN   = "round_robin"
+	SELECTOR_STICKY        = "sticky"
+)
+
+// SenderSelector picks the account relaying param to heco out of senders,
+// which only holds accounts with enough balance and is never empty. param
+// is nil for transactions not bound to a cross chain tx, e.g. changeBookKeeper.
+type SenderSelector interface {
+	Select(senders []*EthSender, param *common2.ToMerkleValue) *EthSender
+}
+
+func NewSenderSelector(name string) (SenderSelector, error) {
+	switch name {
+	case "", SELECTOR_BALANCE:
+		return NewBalanceSelector(rand.NewSource(time.Now().UnixNano())), nil
+	case SELECTOR_LEAST_PENDING:
+		return &LeastPendingSelector{}, nil
+	case SELECTOR_ROUND_ROBIN:
+		return &RoundRobinSelector{}, nil
+	case SELECTOR_STICKY:
+		return &StickySelector{}, nil
+	default:
+		return nil, fmt.Errorf("unknown sender selector %s", name)
+	}
+}
+
+// BalanceSelector picks senders randomly, weighted by their balances
+type BalanceSelector struct {
+	rnd  *rand.Rand
+	lock sync.Mutex
+}
+
+func NewBalanceSelector(src rand.Source) *BalanceSelector {
+	return &BalanceSelector{rnd: rand.New(src)}
+}
+
+func (this *BalanceSelector) Select(senders []*EthSender, param *common2.ToMerkleValue) *EthSender {
+	sum := big.NewInt(0)
+	upper := make([]*big.Int, len(senders))
+	for i, v := range senders {
+		bal, _ := v.cachedBalance()
+		if bal != nil {
+			sum.Add(sum, bal)
+		}
+		upper[i] = new(big.Int).Set(sum)
+	}
+	if sum.Sign() == 0 {
+		return senders[0]
+	}
+	this.lock.Lock()
+	point := new(big.Int).Rand(this.rnd, sum)
+	this.lock.Unlock()
+	// point is in [0, sum), sender i owns [upper[i-1], upper[i])
+	for i, v := range upper {
+		if point.Cmp(v) < 0 {
+			return senders[i]
+		}
+	}
+	return senders[len(senders)-1]
+}
+
+// LeastPendingSelector picks the sender with the fewest transactions waiting
+// to be confirmed, the first one on ties
+type LeastPendingSelector struct{}
+
+func (this *LeastPendingSelector) Select(senders []*EthSender, param *common2.ToMerkleValue) *EthSender {
+	res := senders[0]
+	for _, v := range senders[1:] {
+		if v.Pending() < res.Pending() {
+			res = v
+		}
+	}
+	return res
+}
+
+// RoundRobinSelector picks the senders in turn
+type RoundRobinSelector struct {
+	next uint64
+}
+
+func (this *RoundRobinSelector) Select(senders []*EthSender, param *common2.ToMerkleValue) *EthSender {
+	idx := atomic.AddUint64(&this.next, 1) - 1
+	return senders[idx%uint64(len(senders))]
+}
+
+// StickySelector always relays txs to the same destination contract with the
+// same sender. It uses rendezvous hashing so only the contracts of a sender
+// that gets excluded move to other senders.
+type StickySelector struct{}
+
+func (this *StickySelector) Select(senders []*EthSender, param *common2.ToMerkleValue) *EthSender {
+	if param == nil || param.MakeTxParam == nil {
+		return senders[0]
+	}
+	var (
+		res *EthSender
+		max uint64
+	)
+	for _, v := range senders {
+		h := fnv.New64a()
+		h.Write(param.MakeTxParam.ToContractAddress)
+		h.Write(v.acc.Address.Bytes())
+		if w := h.Sum64(); res == nil || w > max {
+			res, max = v, w
+		}
+	}
+	return res
+}
@@ -0,0 +1,132 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package manager
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	common2 "github.com/polynetwork/poly/native/service/cross_chain_manager/common"
+)
+
+func testSender(i int, balance *big.Int, pending int64) *EthSender {
+	return &EthSender{
+		acc:     accounts.Account{Address: ethcommon.BigToAddress(big.NewInt(int64(i + 1)))},
+		balance: balance,
+		pending: pending,
+	}
+}
+
+func testParam(contract string) *common2.ToMerkleValue {
+	return &common2.ToMerkleValue{
+		MakeTxParam: &common2.MakeTxParam{ToContractAddress: ethcommon.HexToAddress(contract).Bytes()},
+	}
+}
+
+func TestBalanceSelectorBigBalances(t *testing.T) {
+	// 1e30 and 3e30 wei, their sum overflows int64 by far
+	unit, _ := new(big.Int).SetString("1000000000000000000000000000000", 10)
+	senders := []*EthSender{
+		testSender(0, unit, 0),
+		testSender(1, new(big.Int).Mul(unit, big.NewInt(3)), 0),
+		testSender(2, big.NewInt(0), 0),
+	}
+	selector := NewBalanceSelector(rand.NewSource(1))
+	counts := make(map[*EthSender]int)
+	const rounds = 20000
+	for i := 0; i < rounds; i++ {
+		counts[selector.Select(senders, nil)]++
+	}
+	if counts[senders[2]] != 0 {
+		t.Fatalf("sender without balance selected %d times", counts[senders[2]])
+	}
+	if share := float64(counts[senders[1]]) / rounds; share < 0.72 || share > 0.78 {
+		t.Fatalf("sender with 3/4 of the balance got a share of %.3f", share)
+	}
+}
+
+func TestBalanceSelectorNoBalance(t *testing.T) {
+	senders := []*EthSender{testSender(0, nil, 0), testSender(1, big.NewInt(0), 0)}
+	if res := NewBalanceSelector(rand.NewSource(1)).Select(senders, nil); res != senders[0] {
+		t.Fatalf("expected the first sender without any balance, got %s", res.acc.Address.Hex())
+	}
+}
+
+func TestLeastPendingSelector(t *testing.T) {
+	senders := []*EthSender{testSender(0, nil, 3), testSender(1, nil, 1), testSender(2, nil, 1), testSender(3, nil, 2)}
+	selector := &LeastPendingSelector{}
+	if res := selector.Select(senders, nil); res != senders[1] {
+		t.Fatalf("expected the first of the senders with least pending txs, got %s", res.acc.Address.Hex())
+	}
+	senders[1].pending = 5
+	if res := selector.Select(senders, nil); res != senders[2] {
+		t.Fatalf("expected sender 2, got %s", res.acc.Address.Hex())
+	}
+}
+
+func TestRoundRobinSelector(t *testing.T) {
+	senders := []*EthSender{testSender(0, nil, 0), testSender(1, nil, 0), testSender(2, nil, 0)}
+	selector := &RoundRobinSelector{}
+	for i := 0; i < 2*len(senders)+1; i++ {
+		if res := selector.Select(senders, nil); res != senders[i%len(senders)] {
+			t.Fatalf("round %d: expected sender %d, got %s", i, i%len(senders), res.acc.Address.Hex())
+		}
+	}
+	// a shrinking sender list keeps the index in range
+	if res := selector.Select(senders[:2], nil); res != senders[1] {
+		t.Fatalf("expected sender 1, got %s", res.acc.Address.Hex())
+	}
+}
+
+func TestStickySelector(t *testing.T) {
+	senders := make([]*EthSender, 5)
+	for i := range senders {
+		senders[i] = testSender(i, nil, 0)
+	}
+	selector := &StickySelector{}
+	for i := 0; i < 20; i++ {
+		param := testParam(fmt.Sprintf("0x%040x", i+1))
+		res := selector.Select(senders, param)
+		if again := selector.Select(senders, param); again != res {
+			t.Fatalf("contract %d moved from %s to %s", i, res.acc.Address.Hex(), again.acc.Address.Hex())
+		}
+		reversed := make([]*EthSender, len(senders))
+		for j, v := range senders {
+			reversed[len(senders)-1-j] = v
+		}
+		if again := selector.Select(reversed, param); again != res {
+			t.Fatalf("contract %d depends on the order of senders", i)
+		}
+		// excluding another sender doesn't move the contract
+		others := make([]*EthSender, 0, len(senders))
+		for _, v := range senders {
+			if v != res {
+				others = append(others, v)
+			}
+		}
+		if again := selector.Select(append([]*EthSender{res}, others[1:]...), param); again != res {
+			t.Fatalf("contract %d moved after excluding %s", i, others[0].acc.Address.Hex())
+		}
+	}
+	if res := selector.Select(senders, nil); res != senders[0] {
+		t.Fatalf("expected the first sender for txs without param, got %s", res.acc.Address.Hex())
+	}
+}
@@ -0,0 +1,33 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package manager
+
+import (
+	"github.com/polynetwork/heco_relayer/db"
+	"github.com/polynetwork/heco_relayer/log"
+)
+
+// trackTransfer records u in the transfer lifecycle store. Tracking never
+// stops relaying, failures are only logged.
+func trackTransfer(boltDB *db.BoltDB, logger *log.Entry, u *db.TransferUpdate) {
+	if len(u.CrossChainId) == 0 {
+		return
+	}
+	if err := boltDB.UpdateTransfer(u); err != nil {
+		logger.Errorf("trackTransfer - failed to record state %s: %v", u.State, err)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package manager
+
+import (
+	"time"
+
+	"github.com/polynetwork/heco_relayer/health"
+	"github.com/polynetwork/heco_relayer/log"
+	"github.com/polynetwork/heco_relayer/tools"
+)
+
+// names of the monitoring routines reporting heartbeats
+const (
+	HEARTBEAT_MONITOR_HECO_CHAIN   = "MonitorHecoChain"
+	HEARTBEAT_COMMIT_HECO_PROOF    = "RegularlyTryCommitHecoLockProofToPoly"
+	HEARTBEAT_CHECK_HECO_DEPOSIT   = "CheckDeposit"
+	HEARTBEAT_MONITOR_POLY_CHAIN   = "MonitorPolyChain"
+	HEARTBEAT_MONITOR_POLY_DEPOSIT = "MonitorDeposit"
+	HEARTBEAT_MONITOR_POLY_EPOCH   = "MonitorEpoch"
+)
+
+// RegisterHeartbeats should be called before the managers start, so a
+// routine which never starts is reported as well
+func RegisterHeartbeats(timeout time.Duration) {
+	for _, name := range []string{
+		HEARTBEAT_MONITOR_HECO_CHAIN,
+		HEARTBEAT_COMMIT_HECO_PROOF,
+		HEARTBEAT_CHECK_HECO_DEPOSIT,
+		HEARTBEAT_MONITOR_POLY_CHAIN,
+		HEARTBEAT_MONITOR_POLY_DEPOSIT,
+		HEARTBEAT_MONITOR_POLY_EPOCH,
+	} {
+		health.Register(name, timeout)
+	}
+}
+
+// chainsDegraded tells the caller to skip this round when one of the chains
+// it depends on has stalled. Pass nil for a chain the caller doesn't use.
+func chainsDegraded(caller string, heco *tools.HecoClient, poly *tools.PolyClient) bool {
+	if heco != nil && heco.Degraded() {
+		log.Warnf("%s - heco chain is degraded, paused", caller)
+		return true
+	}
+	if poly != nil && poly.Degraded() {
+		log.Warnf("%s - poly chain is degraded, paused", caller)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package notify
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/polynetwork/heco_relayer/config"
+	"github.com/polynetwork/heco_relayer/log"
+)
+
+// kinds of events
+const (
+	EVENT_RELAY_FAILED       = "relay_failed"       // a tx failed on poly or heco
+	EVENT_HEADER_SYNC_FAILED = "header_sync_failed" // heco headers could not be synced to poly
+	EVENT_LOW_BALANCE        = "low_balance"        // a heco sender is excluded for low balance
+	EVENT_SYNC_STALLED       = "sync_stalled"       // the head of a chain stopped advancing
+)
+
+const sink_queue_size = 100
+
+type Event struct {
+	Kind    string
+	Subject string // what the event is about, e.g. a tx hash or an address, events are throttled per kind and subject
+	Message string
+	Fields  map[string]string `json:",omitempty"`
+	Time    time.Time
+}
+
+// Sink delivers events somewhere, Send may block while it retries
+type Sink interface {
+	Name() string
+	Send(event *Event) error
+}
+
+type sinkQueue struct {
+	sink   Sink
+	events chan *Event
+}
+
+func (this *sinkQueue) run() {
+	for event := range this.events {
+		if err := this.sink.Send(event); err != nil {
+			log.Errorf("notify - sink %s failed to send %s event about %s: %v", this.sink.Name(), event.Kind, event.Subject, err)
+		}
+	}
+}
+
+// Notifier hands events to its sinks without blocking the caller. The same
+// kind of event about the same subject is sent once per throttle.
+type Notifier struct {
+	sinks    []*sinkQueue
+	throttle time.Duration
+	last     map[string]time.Time
+	lock     sync.Mutex
+}
+
+func NewNotifier() *Notifier {
+	return &Notifier{
+		throttle: config.DEFAULT_NOTIFY_THROTTLE,
+		last:     make(map[string]time.Time),
+	}
+}
+
+var Default = NewNotifier()
+
+// AddSink starts delivering events to sink in its own routine
+func (this *Notifier) AddSink(sink Sink) {
+	q := &sinkQueue{sink: sink, events: make(chan *Event, sink_queue_size)}
+	this.lock.Lock()
+	this.sinks = append(this.sinks, q)
+	this.lock.Unlock()
+	go q.run()
+}
+
+func (this *Notifier) SetThrottle(throttle time.Duration) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.throttle = throttle
+}
+
+func (this *Notifier) Notify(event *Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if len(this.sinks) == 0 {
+		return
+	}
+	key := event.Kind + "/" + event.Subject
+	if last, ok := this.last[key]; ok && event.Time.Sub(last) < this.throttle {
+		return
+	}
+	this.last[key] = event.Time
+	for k, t := range this.last {
+		if event.Time.Sub(t) >= this.throttle {
+			delete(this.last, k)
+		}
+	}
+	for _, q := range this.sinks {
+		select {
+		case q.events <- event:
+		default:
+			log.Warnf("notify - queue of sink %s is full, drop %s event about %s", q.sink.Name(), event.Kind, event.Subject)
+		}
+	}
+}
+
+// Setup adds the sinks configured in cfg to Default, nil cfg disables notifications
+func Setup(cfg *config.NotifyConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.Throttle > 0 {
+		Default.SetThrottle(time.Duration(cfg.Throttle) * time.Second)
+	}
+	for i, v := range cfg.Webhooks {
+		sink, err := NewWebhookSink(v)
+		if err != nil {
+			return fmt.Errorf("webhook %d: %v", i, err)
+		}
+		Default.AddSink(sink)
+	}
+	return nil
+}
+
+func Notify(event *Event) {
+	Default.Notify(event)
+}
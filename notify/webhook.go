@@ -0,0 +1,218 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/polynetwork/heco_relayer/config"
+)
+
+// SIGNATURE_HEADER carries "sha256=" and the hex HMAC-SHA256 of the body keyed by the webhook secret
+const SIGNATURE_HEADER = "X-Signature-256"
+
+const max_webhook_backoff = time.Minute
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		raw, err := json.Marshal(v)
+		return string(raw), err
+	},
+}
+
+// templates are the built-in payload formats, "json" sends the event as it is
+var templates = map[string]string{
+	"json":  "",
+	"slack": `{"text": {{json (printf "[%s] %s: %s" .Kind .Subject .Message)}}}`,
+}
+
+// RegisterTemplate adds a payload format webhooks can refer to by name
+func RegisterTemplate(name, text string) error {
+	if _, err := template.New(name).Funcs(templateFuncs).Parse(text); err != nil {
+		return err
+	}
+	templates[name] = text
+	return nil
+}
+
+// WebhookSink posts events as JSON, rendered by a template if configured, and
+// retries with exponential backoff on transport errors, 429 and 5xx answers.
+type WebhookSink struct {
+	url      string
+	secret   []byte
+	template *template.Template
+	kinds    map[string]bool
+	retries  int
+	backoff  time.Duration
+	client   *http.Client
+}
+
+func NewWebhookSink(cfg *config.WebhookConfig) (*WebhookSink, error) {
+	if cfg.Url == "" {
+		return nil, fmt.Errorf("no url")
+	}
+	this := &WebhookSink{
+		url:     cfg.Url,
+		secret:  []byte(cfg.Secret),
+		kinds:   make(map[string]bool),
+		retries: cfg.MaxRetries,
+		backoff: time.Second,
+		client:  &http.Client{Timeout: config.DEFAULT_WEBHOOK_TIMEOUT},
+	}
+	if this.retries == 0 {
+		this.retries = config.DEFAULT_WEBHOOK_RETRIES
+	}
+	if cfg.Timeout > 0 {
+		this.client.Timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	for _, kind := range cfg.Events {
+		this.kinds[kind] = true
+	}
+	text, ok := templates[cfg.Template]
+	if !ok {
+		text = cfg.Template
+	}
+	if text != "" {
+		tmpl, err := template.New(cfg.Url).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %v", err)
+		}
+		this.template = tmpl
+	}
+	return this, nil
+}
+
+func (this *WebhookSink) Name() string {
+	return this.url
+}
+
+func (this *WebhookSink) render(event *Event) ([]byte, error) {
+	if this.template == nil {
+		return json.Marshal(event)
+	}
+	buf := new(bytes.Buffer)
+	if err := this.template.Execute(buf, event); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (this *WebhookSink) Send(event *Event) error {
+	if len(this.kinds) > 0 && !this.kinds[event.Kind] {
+		return nil
+	}
+	body, err := this.render(event)
+	if err != nil {
+		return fmt.Errorf("failed to render event: %v", err)
+	}
+	backoff := this.backoff
+	for i := 0; ; i++ {
+		retry, err := this.post(body)
+		if err == nil || !retry || i >= this.retries {
+			return err
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > max_webhook_backoff {
+			backoff = max_webhook_backoff
+		}
+	}
+}
+
+// post sends body once and tells if a failure is worth retrying
+func (this *WebhookSink) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, this.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(this.secret) > 0 {
+		req.Header.Set(SIGNATURE_HEADER, Sign(this.secret, body))
+	}
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	msg, _ := ioutil.ReadAll(resp.Body)
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook answered %s: %s", resp.Status, msg)
+}
+
+// Sign returns the value of SIGNATURE_HEADER for body
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookStub is an http.Handler receiving webhooks, so sinks can be run
+// against an httptest server. It rejects bodies not signed with its secret
+// and fails the first failures requests with 503.
+type WebhookStub struct {
+	secret   []byte
+	failures int
+	received [][]byte
+	lock     sync.Mutex
+}
+
+func NewWebhookStub(secret string, failures int) *WebhookStub {
+	return &WebhookStub{secret: []byte(secret), failures: failures}
+}
+
+// Received returns the bodies accepted so far
+func (this *WebhookStub) Received() [][]byte {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return append([][]byte{}, this.received...)
+}
+
+func (this *WebhookStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(this.secret) > 0 && !hmac.Equal([]byte(r.Header.Get(SIGNATURE_HEADER)), []byte(Sign(this.secret, body))) {
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+		return
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.failures > 0 {
+		this.failures--
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+		return
+	}
+	this.received = append(this.received, body)
+}
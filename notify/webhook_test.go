@@ -0,0 +1,190 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/polynetwork/heco_relayer/config"
+)
+
+func testEvent() *Event {
+	return &Event{
+		Kind:    EVENT_RELAY_FAILED,
+		Subject: "0xabc",
+		Message: "tx failed",
+		Fields:  map[string]string{"poly_tx": "0123"},
+		Time:    time.Unix(1600000000, 0),
+	}
+}
+
+func testSink(t *testing.T, cfg *config.WebhookConfig) *WebhookSink {
+	sink, err := NewWebhookSink(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.backoff = 10 * time.Millisecond
+	return sink
+}
+
+func TestWebhookSignature(t *testing.T) {
+	stub := NewWebhookStub("secret", 0)
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	if err := testSink(t, &config.WebhookConfig{Url: server.URL, Secret: "secret"}).Send(testEvent()); err != nil {
+		t.Fatalf("signed event rejected: %v", err)
+	}
+	if err := testSink(t, &config.WebhookConfig{Url: server.URL, Secret: "other"}).Send(testEvent()); err == nil {
+		t.Fatal("event signed with another secret accepted")
+	}
+	if err := testSink(t, &config.WebhookConfig{Url: server.URL}).Send(testEvent()); err == nil {
+		t.Fatal("unsigned event accepted")
+	}
+	received := stub.Received()
+	if len(received) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(received))
+	}
+	event := new(Event)
+	if err := json.Unmarshal(received[0], event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Kind != EVENT_RELAY_FAILED || event.Subject != "0xabc" || event.Fields["poly_tx"] != "0123" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	stub := NewWebhookStub("", 2)
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	start := time.Now()
+	if err := testSink(t, &config.WebhookConfig{Url: server.URL, MaxRetries: 3}).Send(testEvent()); err != nil {
+		t.Fatalf("event not delivered after retries: %v", err)
+	}
+	// waits 10ms then 20ms before the third attempt
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Fatalf("retried without backoff, took %s", elapsed)
+	}
+	if n := len(stub.Received()); n != 1 {
+		t.Fatalf("expected 1 event, got %d", n)
+	}
+
+	stub = NewWebhookStub("", 5)
+	server2 := httptest.NewServer(stub)
+	defer server2.Close()
+	if err := testSink(t, &config.WebhookConfig{Url: server2.URL, MaxRetries: 2}).Send(testEvent()); err == nil {
+		t.Fatal("expected an error once retries are exhausted")
+	}
+}
+
+func TestWebhookNoRetryOnClientError(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	if err := testSink(t, &config.WebhookConfig{Url: server.URL, MaxRetries: 3}).Send(testEvent()); err == nil {
+		t.Fatal("expected an error on 400")
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("expected 1 attempt on 400, got %d", n)
+	}
+}
+
+func TestWebhookTemplates(t *testing.T) {
+	stub := NewWebhookStub("", 0)
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	if err := testSink(t, &config.WebhookConfig{Url: server.URL, Template: "slack"}).Send(testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	custom := `{"alert": {{json .Kind}}, "tx": {{json (index .Fields "poly_tx")}}}`
+	if err := testSink(t, &config.WebhookConfig{Url: server.URL, Template: custom}).Send(testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	received := stub.Received()
+	if len(received) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(received))
+	}
+	slack := make(map[string]string)
+	if err := json.Unmarshal(received[0], &slack); err != nil {
+		t.Fatalf("invalid slack payload %s: %v", received[0], err)
+	}
+	if slack["text"] != "[relay_failed] 0xabc: tx failed" {
+		t.Fatalf("unexpected slack text %q", slack["text"])
+	}
+	if string(received[1]) != `{"alert": "relay_failed", "tx": "0123"}` {
+		t.Fatalf("unexpected custom payload %s", received[1])
+	}
+
+	if _, err := NewWebhookSink(&config.WebhookConfig{Url: server.URL, Template: "{{.Kind"}); err == nil {
+		t.Fatal("invalid template accepted")
+	}
+}
+
+type chanSink chan *Event
+
+func (this chanSink) Name() string { return "chan" }
+
+func (this chanSink) Send(event *Event) error {
+	this <- event
+	return nil
+}
+
+func TestNotifierThrottle(t *testing.T) {
+	sink := make(chanSink, 10)
+	notifier := NewNotifier()
+	notifier.SetThrottle(time.Minute)
+	notifier.AddSink(sink)
+
+	now := time.Now()
+	send := func(kind, subject string, at time.Time) {
+		notifier.Notify(&Event{Kind: kind, Subject: subject, Time: at})
+	}
+	send(EVENT_RELAY_FAILED, "a", now)
+	send(EVENT_RELAY_FAILED, "a", now.Add(30*time.Second)) // throttled
+	send(EVENT_RELAY_FAILED, "b", now.Add(30*time.Second))
+	send(EVENT_LOW_BALANCE, "a", now.Add(30*time.Second))
+	send(EVENT_RELAY_FAILED, "a", now.Add(61*time.Second))
+
+	expected := []string{"relay_failed/a", "relay_failed/b", "low_balance/a", "relay_failed/a"}
+	for i, want := range expected {
+		select {
+		case event := <-sink:
+			if got := event.Kind + "/" + event.Subject; got != want {
+				t.Fatalf("event %d: expected %s, got %s", i, want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d (%s) not delivered", i, want)
+		}
+	}
+	select {
+	case event := <-sink:
+		t.Fatalf("unexpected event %s/%s", event.Kind, event.Subject)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,474 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package tools
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/polynetwork/heco_relayer/config"
+	"github.com/polynetwork/heco_relayer/log"
+)
+
+const (
+	heco_health_check_interval = 5 * time.Second
+	max_endpoint_error_rate    = 0.5
+	ewma_weight                = 0.2
+)
+
+type hecoEndpoint struct {
+	url     string
+	client  *ethclient.Client
+	height  uint64
+	errRate float64       // moving average of failed calls, 0 ~ 1
+	latency time.Duration // moving average of call latency
+}
+
+// HecoClient spreads heco rpc calls over several endpoints. Every call goes
+// to the healthiest endpoint and fails over to the next one on transport
+// errors. It implements bind.ContractBackend so contract bindings use it too.
+type HecoClient struct {
+	endpoints  []*hecoEndpoint
+	restClient *RestClient
+	quorum     int
+	maxLag     uint64
+	current    *hecoEndpoint
+	head       *headTracker
+	lock       sync.RWMutex
+}
+
+func NewHecoClient(cfg *config.HecoConfig) (*HecoClient, error) {
+	urls := cfg.GetRestURLs()
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("NewHecoClient - no heco rpc endpoint configured")
+	}
+	if cfg.RpcQuorum > len(urls) {
+		return nil, fmt.Errorf("NewHecoClient - rpc quorum %d is larger than endpoint number %d", cfg.RpcQuorum, len(urls))
+	}
+	this := &HecoClient{
+		restClient: NewRestClient(),
+		quorum:     cfg.RpcQuorum,
+		maxLag:     cfg.MaxHeightLag,
+	}
+	if this.maxLag == 0 {
+		this.maxLag = config.DEFAULT_MAX_HEIGHT_LAG
+	}
+	for _, url := range urls {
+		client, err := ethclient.Dial(url)
+		if err != nil {
+			return nil, fmt.Errorf("NewHecoClient - cannot dial %s: %v", url, err)
+		}
+		this.endpoints = append(this.endpoints, &hecoEndpoint{url: url, client: client})
+	}
+	stallTimeout := time.Duration(cfg.StallTimeout) * time.Second
+	if stallTimeout == 0 {
+		stallTimeout = config.DEFAULT_HECO_STALL_TIMEOUT
+	}
+	this.head = newHeadTracker("heco", stallTimeout)
+	this.checkHealth()
+	go this.monitorHealth()
+	return this, nil
+}
+
+func (this *HecoClient) monitorHealth() {
+	ticker := time.NewTicker(heco_health_check_interval)
+	for range ticker.C {
+		this.checkHealth()
+	}
+}
+
+// checkHealth probes the height of every endpoint
+func (this *HecoClient) checkHealth() {
+	var wg sync.WaitGroup
+	for _, ep := range this.endpoints {
+		wg.Add(1)
+		go func(ep *hecoEndpoint) {
+			defer wg.Done()
+			start := time.Now()
+			height, err := GetNodeHeight(ep.url, this.restClient)
+			this.report(ep, err, time.Since(start))
+			if err != nil {
+				log.Warnf("HecoClient - failed to get height of %s: %v", ep.url, err)
+				return
+			}
+			this.lock.Lock()
+			ep.height = height
+			this.lock.Unlock()
+		}(ep)
+	}
+	wg.Wait()
+	this.lock.Lock()
+	this.pickCurrent()
+	this.head.update(this.maxHeight())
+	this.lock.Unlock()
+}
+
+func (this *HecoClient) report(ep *hecoEndpoint, err error, latency time.Duration) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	failed := 0.0
+	if err != nil {
+		failed = 1
+	}
+	ep.errRate = ep.errRate*(1-ewma_weight) + failed*ewma_weight
+	if err == nil {
+		if ep.latency == 0 {
+			ep.latency = latency
+		} else {
+			ep.latency = time.Duration(float64(ep.latency)*(1-ewma_weight) + float64(latency)*ewma_weight)
+		}
+	}
+	if err != nil && ep == this.current {
+		this.pickCurrent()
+	}
+}
+
+func (this *HecoClient) maxHeight() uint64 {
+	var max uint64
+	for _, ep := range this.endpoints {
+		if ep.height > max {
+			max = ep.height
+		}
+	}
+	return max
+}
+
+func (this *HecoClient) healthy(ep *hecoEndpoint, maxHeight uint64) bool {
+	return ep.errRate < max_endpoint_error_rate && ep.height+this.maxLag >= maxHeight
+}
+
+// best returns the endpoint not in excluded with the best score: healthy ones
+// by latency weighted with error rate, otherwise the highest one.
+func (this *HecoClient) best(excluded map[*hecoEndpoint]bool) *hecoEndpoint {
+	maxHeight := this.maxHeight()
+	var (
+		res      *hecoEndpoint
+		resScore float64
+		fallback *hecoEndpoint
+	)
+	for _, ep := range this.endpoints {
+		if excluded[ep] {
+			continue
+		}
+		if this.healthy(ep, maxHeight) {
+			score := float64(ep.latency) * (1 + ep.errRate)
+			if res == nil || score < resScore {
+				res, resScore = ep, score
+			}
+		} else if fallback == nil || ep.height > fallback.height {
+			fallback = ep
+		}
+	}
+	if res == nil {
+		return fallback
+	}
+	return res
+}
+
+func (this *HecoClient) pickCurrent() {
+	ep := this.best(nil)
+	if ep != this.current {
+		if this.current != nil {
+			log.Warnf("HecoClient - switch heco endpoint from %s to %s (height: %d)", this.current.url, ep.url, ep.height)
+		}
+		this.current = ep
+	}
+}
+
+// Url returns the endpoint currently in use
+func (this *HecoClient) Url() string {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.current.url
+}
+
+func isTransportError(err error) bool {
+	if err == nil || err == ethereum.NotFound || err == context.Canceled {
+		return false
+	}
+	if _, ok := err.(rpc.Error); ok {
+		return false
+	}
+	return true
+}
+
+// do runs f against the current endpoint and fails over to the others
+// as long as f returns a transport error
+func (this *HecoClient) do(f func(ep *hecoEndpoint) error, isFailure func(error) bool) error {
+	tried := make(map[*hecoEndpoint]bool)
+	this.lock.RLock()
+	ep := this.current
+	this.lock.RUnlock()
+	var err error
+	for ep != nil {
+		tried[ep] = true
+		start := time.Now()
+		err = f(ep)
+		if !isFailure(err) {
+			this.report(ep, nil, time.Since(start))
+			return err
+		}
+		this.report(ep, err, time.Since(start))
+		log.Warnf("HecoClient - call to %s failed: %v", ep.url, err)
+		this.lock.RLock()
+		ep = this.best(tried)
+		this.lock.RUnlock()
+	}
+	return err
+}
+
+func (this *HecoClient) call(f func(client *ethclient.Client) error) error {
+	return this.do(func(ep *hecoEndpoint) error {
+		return f(ep.client)
+	}, isTransportError)
+}
+
+func (this *HecoClient) rest(f func(url string) error) error {
+	return this.do(func(ep *hecoEndpoint) error {
+		return f(ep.url)
+	}, func(err error) bool {
+		return err != nil
+	})
+}
+
+func (this *HecoClient) GetNodeHeight() (height uint64, err error) {
+	err = this.do(func(ep *hecoEndpoint) error {
+		height, err = GetNodeHeight(ep.url, this.restClient)
+		if err == nil {
+			this.lock.Lock()
+			ep.height = height
+			this.lock.Unlock()
+		}
+		return err
+	}, func(err error) bool {
+		return err != nil
+	})
+	return
+}
+
+func (this *HecoClient) GetProof(contractAddress string, key string, blockheight string) (proof []byte, err error) {
+	err = this.rest(func(url string) error {
+		proof, err = GetProof(url, contractAddress, key, blockheight, this.restClient)
+		return err
+	})
+	return
+}
+
+// HeaderByNumberQuorum asks every endpoint for the header and only returns
+// one that at least RpcQuorum endpoints agree on. Without quorum configured
+// it is the same as HeaderByNumber.
+func (this *HecoClient) HeaderByNumberQuorum(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if this.quorum <= 1 {
+		return this.HeaderByNumber(ctx, number)
+	}
+	type result struct {
+		ep  *hecoEndpoint
+		hdr *types.Header
+		err error
+	}
+	results := make(chan *result, len(this.endpoints))
+	for _, ep := range this.endpoints {
+		go func(ep *hecoEndpoint) {
+			start := time.Now()
+			hdr, err := ep.client.HeaderByNumber(ctx, number)
+			if isTransportError(err) {
+				this.report(ep, err, time.Since(start))
+			} else {
+				this.report(ep, nil, time.Since(start))
+			}
+			results <- &result{ep, hdr, err}
+		}(ep)
+	}
+	votes := make(map[common.Hash]int)
+	for range this.endpoints {
+		res := <-results
+		if res.err != nil {
+			log.Warnf("HecoClient - failed to get header %s from %s: %v", number.String(), res.ep.url, res.err)
+			continue
+		}
+		hash := res.hdr.Hash()
+		votes[hash]++
+		if votes[hash] >= this.quorum {
+			return res.hdr, nil
+		}
+	}
+	return nil, fmt.Errorf("HeaderByNumberQuorum - less than %d endpoints agree on header %s: %v", this.quorum, number.String(), votes)
+}
+
+func (this *HecoClient) ChainID(ctx context.Context) (id *big.Int, err error) {
+	err = this.call(func(client *ethclient.Client) error {
+		id, err = client.ChainID(ctx)
+		return err
+	})
+	return
+}
+
+func (this *HecoClient) HeaderByNumber(ctx context.Context, number *big.Int) (hdr *types.Header, err error) {
+	err = this.call(func(client *ethclient.Client) error {
+		hdr, err = client.HeaderByNumber(ctx, number)
+		return err
+	})
+	return
+}
+
+func (this *HecoClient) TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, isPending bool, err error) {
+	err = this.call(func(client *ethclient.Client) error {
+		tx, isPending, err = client.TransactionByHash(ctx, hash)
+		return err
+	})
+	return
+}
+
+func (this *HecoClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (receipt *types.Receipt, err error) {
+	err = this.call(func(client *ethclient.Client) error {
+		receipt, err = client.TransactionReceipt(ctx, txHash)
+		return err
+	})
+	return
+}
+
+func (this *HecoClient) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (balance *big.Int, err error) {
+	err = this.call(func(client *ethclient.Client) error {
+		balance, err = client.BalanceAt(ctx, account, blockNumber)
+		return err
+	})
+	return
+}
+
+func (this *HecoClient) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (nonce uint64, err error) {
+	err = this.call(func(client *ethclient.Client) error {
+		nonce, err = client.NonceAt(ctx, account, blockNumber)
+		return err
+	})
+	return
+}
+
+func (this *HecoClient) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) (code []byte, err error) {
+	err = this.call(func(client *ethclient.Client) error {
+		code, err = client.CodeAt(ctx, account, blockNumber)
+		return err
+	})
+	return
+}
+
+func (this *HecoClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) (res []byte, err error) {
+	err = this.call(func(client *ethclient.Client) error {
+		res, err = client.CallContract(ctx, msg, blockNumber)
+		return err
+	})
+	return
+}
+
+func (this *HecoClient) PendingCodeAt(ctx context.Context, account common.Address) (code []byte, err error) {
+	err = this.call(func(client *ethclient.Client) error {
+		code, err = client.PendingCodeAt(ctx, account)
+		return err
+	})
+	return
+}
+
+func (this *HecoClient) PendingNonceAt(ctx context.Context, account common.Address) (nonce uint64, err error) {
+	err = this.call(func(client *ethclient.Client) error {
+		nonce, err = client.PendingNonceAt(ctx, account)
+		return err
+	})
+	return
+}
+
+func (this *HecoClient) SuggestGasPrice(ctx context.Context) (price *big.Int, err error) {
+	err = this.call(func(client *ethclient.Client) error {
+		price, err = client.SuggestGasPrice(ctx)
+		return err
+	})
+	return
+}
+
+func (this *HecoClient) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (gas uint64, err error) {
+	err = this.call(func(client *ethclient.Client) error {
+		gas, err = client.EstimateGas(ctx, msg)
+		return err
+	})
+	return
+}
+
+func (this *HecoClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return this.call(func(client *ethclient.Client) error {
+		return client.SendTransaction(ctx, tx)
+	})
+}
+
+func (this *HecoClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery) (logs []types.Log, err error) {
+	err = this.call(func(client *ethclient.Client) error {
+		logs, err = client.FilterLogs(ctx, q)
+		return err
+	})
+	return
+}
+
+func (this *HecoClient) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (sub ethereum.Subscription, err error) {
+	err = this.call(func(client *ethclient.Client) error {
+		sub, err = client.SubscribeFilterLogs(ctx, q, ch)
+		return err
+	})
+	return
+}
+
+// Degraded tells if the heco head has stalled, work depending on heco should pause
+func (this *HecoClient) Degraded() bool {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.head.degraded
+}
+
+func (this *HecoClient) Status() *ChainStatus {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	status := this.head.status()
+	for _, ep := range this.endpoints {
+		status.Endpoints = append(status.Endpoints, &EndpointStatus{
+			Url:     ep.url,
+			Height:  ep.height,
+			ErrRate: ep.errRate,
+			Latency: ep.latency.String(),
+		})
+	}
+	return status
+}
+
+// CheckHealth fails when the heco head stalled or no endpoint is healthy
+func (this *HecoClient) CheckHealth() error {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	if this.head.degraded {
+		return fmt.Errorf("heco head stalled at %d since %s", this.head.height, this.head.lastProgress.Format(time.RFC3339))
+	}
+	maxHeight := this.maxHeight()
+	for _, ep := range this.endpoints {
+		if this.healthy(ep, maxHeight) {
+			return nil
+		}
+	}
+	return fmt.Errorf("no healthy heco endpoint")
+}
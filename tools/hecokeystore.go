@@ -69,6 +69,16 @@ func (this *HecoKeyStore) SignTransaction(tx *types.Transaction, acc accounts.Ac
 	return tx, nil
 }
 
+// CheckUnlocked makes sure every account can still sign
+func (this *HecoKeyStore) CheckUnlocked() error {
+	for _, v := range this.GetAccounts() {
+		if _, err := this.ks.SignHash(v, make([]byte, 32)); err != nil {
+			return fmt.Errorf("heco acc %s can not sign: %v", v.Address.String(), err)
+		}
+	}
+	return nil
+}
+
 func (this *HecoKeyStore) GetAccounts() []accounts.Account {
 	return this.ks.Accounts()
 }
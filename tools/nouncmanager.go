@@ -23,7 +23,6 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/polynetwork/heco_relayer/log"
 )
 
@@ -32,11 +31,11 @@ const clear_nonce_interval = 10 * time.Minute
 type NonceManager struct {
 	addressNonce  map[common.Address]uint64
 	returnedNonce map[common.Address]SortedNonceArr
-	ethClient     *ethclient.Client
+	ethClient     *HecoClient
 	lock          sync.Mutex
 }
 
-func NewNonceManager(ethClient *ethclient.Client) *NonceManager {
+func NewNonceManager(ethClient *HecoClient) *NonceManager {
 	nonceManager := &NonceManager{
 		addressNonce:  make(map[common.Address]uint64),
 		ethClient:     ethClient,
@@ -87,6 +86,21 @@ func (this *NonceManager) ReturnNonce(addr common.Address, nonce uint64) {
 	this.returnedNonce[addr] = arr
 }
 
+// ResyncAddressNonce continues with the pending nonce of address on the
+// network, dropping the cached and returned ones, e.g. after "nonce too low"
+func (this *NonceManager) ResyncAddressNonce(address common.Address) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	nonce, err := this.ethClient.PendingNonceAt(context.Background(), address)
+	if err != nil {
+		return err
+	}
+	this.addressNonce[address] = nonce
+	delete(this.returnedNonce, address)
+	return nil
+}
+
 func (this *NonceManager) DecreaseAddressNonce(address common.Address) {
 	this.lock.Lock()
 	defer this.lock.Unlock()
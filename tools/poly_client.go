@@ -0,0 +1,485 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/polynetwork/heco_relayer/config"
+	"github.com/polynetwork/heco_relayer/log"
+	sdk "github.com/polynetwork/poly-go-sdk"
+	sdkcom "github.com/polynetwork/poly-go-sdk/common"
+	sdkutils "github.com/polynetwork/poly-go-sdk/utils"
+	"github.com/polynetwork/poly/common"
+	"github.com/polynetwork/poly/core/types"
+)
+
+const (
+	poly_health_check_interval = 5 * time.Second
+	poly_send_timeout          = 60 * time.Second
+)
+
+type polyEndpoint struct {
+	url     string
+	sdk     *sdk.PolySdk
+	height  uint32
+	errRate float64 // moving average of failed calls, 0 ~ 1
+}
+
+// PolyClient spreads poly rpc calls over several endpoints. Reads go to the
+// healthiest endpoint, transactions stick to one endpoint until it fails so
+// they are not scattered over nodes with different tx pools.
+type PolyClient struct {
+	endpoints []*polyEndpoint
+	maxLag    uint32
+	current   *polyEndpoint // for reads
+	sticky    *polyEndpoint // for transactions
+	head      *headTracker
+	http      *http.Client // for transactions
+	lock      sync.RWMutex
+}
+
+// PolyRpcError is an error answered by a poly node, so the request has been
+// handled by the node
+type PolyRpcError struct {
+	Code   int64
+	Desc   string
+	Result string
+}
+
+func (this *PolyRpcError) Error() string {
+	return fmt.Sprintf("JsonRpcResponse error code:%d desc:%s result:%s", this.Code, this.Desc, this.Result)
+}
+
+// polyNotSentError means the transaction never left the relayer, no
+// connection to the endpoint could be made
+type polyNotSentError struct {
+	err error
+}
+
+func (this *polyNotSentError) Error() string {
+	return this.err.Error()
+}
+
+func NewPolyClient(cfg *config.PolyConfig) (*PolyClient, error) {
+	urls := cfg.GetRestURLs()
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("NewPolyClient - no poly rpc endpoint configured")
+	}
+	this := &PolyClient{
+		maxLag: uint32(cfg.MaxHeightLag),
+		http:   &http.Client{Timeout: poly_send_timeout},
+	}
+	if this.maxLag == 0 {
+		this.maxLag = config.DEFAULT_MAX_HEIGHT_LAG
+	}
+	var genesis *types.Header
+	for _, url := range urls {
+		polySdk := sdk.NewPolySdk()
+		polySdk.NewRpcClient().SetAddress(url)
+		if genesis == nil {
+			hdr, err := polySdk.GetHeaderByHeight(0)
+			if err != nil {
+				log.Warnf("NewPolyClient - failed to get genesis header from %s: %v", url, err)
+			} else {
+				genesis = hdr
+			}
+		}
+		this.endpoints = append(this.endpoints, &polyEndpoint{url: url, sdk: polySdk})
+	}
+	if genesis == nil {
+		return nil, fmt.Errorf("NewPolyClient - none of the poly endpoints is available")
+	}
+	for _, ep := range this.endpoints {
+		ep.sdk.SetChainId(genesis.ChainID)
+	}
+	stallTimeout := time.Duration(cfg.StallTimeout) * time.Second
+	if stallTimeout == 0 {
+		stallTimeout = config.DEFAULT_POLY_STALL_TIMEOUT
+	}
+	this.head = newHeadTracker("poly", stallTimeout)
+	this.checkHealth()
+	go this.monitorHealth()
+	return this, nil
+}
+
+func (this *PolyClient) monitorHealth() {
+	ticker := time.NewTicker(poly_health_check_interval)
+	for range ticker.C {
+		this.checkHealth()
+	}
+}
+
+// checkHealth probes the height of every endpoint
+func (this *PolyClient) checkHealth() {
+	var wg sync.WaitGroup
+	for _, ep := range this.endpoints {
+		wg.Add(1)
+		go func(ep *polyEndpoint) {
+			defer wg.Done()
+			height, err := ep.sdk.GetCurrentBlockHeight()
+			this.report(ep, err)
+			if err != nil {
+				log.Warnf("PolyClient - failed to get height of %s: %v", ep.url, err)
+				return
+			}
+			this.lock.Lock()
+			ep.height = height
+			this.lock.Unlock()
+		}(ep)
+	}
+	wg.Wait()
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.pickCurrent()
+	if this.sticky == nil || !this.healthy(this.sticky, this.maxHeight()) {
+		this.pickSticky()
+	}
+	this.head.update(uint64(this.maxHeight()))
+}
+
+func (this *PolyClient) report(ep *polyEndpoint, err error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	failed := 0.0
+	if err != nil {
+		failed = 1
+	}
+	ep.errRate = ep.errRate*(1-ewma_weight) + failed*ewma_weight
+	if err == nil {
+		return
+	}
+	if ep == this.current {
+		this.pickCurrent()
+	}
+	if ep == this.sticky {
+		this.pickSticky()
+	}
+}
+
+func (this *PolyClient) maxHeight() uint32 {
+	var max uint32
+	for _, ep := range this.endpoints {
+		if ep.height > max {
+			max = ep.height
+		}
+	}
+	return max
+}
+
+func (this *PolyClient) healthy(ep *polyEndpoint, maxHeight uint32) bool {
+	return ep.errRate < max_endpoint_error_rate && ep.height+this.maxLag >= maxHeight
+}
+
+// best returns the healthy endpoint not in excluded with the lowest error
+// rate, otherwise the highest one
+func (this *PolyClient) best(excluded map[*polyEndpoint]bool) *polyEndpoint {
+	maxHeight := this.maxHeight()
+	var res, fallback *polyEndpoint
+	for _, ep := range this.endpoints {
+		if excluded[ep] {
+			continue
+		}
+		if this.healthy(ep, maxHeight) {
+			if res == nil || ep.errRate < res.errRate {
+				res = ep
+			}
+		} else if fallback == nil || ep.height > fallback.height {
+			fallback = ep
+		}
+	}
+	if res == nil {
+		return fallback
+	}
+	return res
+}
+
+func (this *PolyClient) pickCurrent() {
+	ep := this.best(nil)
+	if ep != this.current {
+		if this.current != nil {
+			log.Warnf("PolyClient - switch poly endpoint for reads from %s to %s (height: %d)", this.current.url, ep.url, ep.height)
+		}
+		this.current = ep
+	}
+}
+
+func (this *PolyClient) pickSticky() {
+	ep := this.best(map[*polyEndpoint]bool{this.sticky: this.sticky != nil && len(this.endpoints) > 1})
+	if ep != nil && ep != this.sticky {
+		if this.sticky != nil {
+			log.Warnf("PolyClient - switch poly endpoint for transactions from %s to %s (height: %d)", this.sticky.url, ep.url, ep.height)
+		}
+		this.sticky = ep
+	}
+}
+
+func isPolyTransportError(err error) bool {
+	return err != nil && !strings.Contains(err.Error(), "JsonRpcResponse error code")
+}
+
+// do runs the read f against start and fails over to the other endpoints as
+// long as f returns a transport error
+func (this *PolyClient) do(start *polyEndpoint, f func(polySdk *sdk.PolySdk) error) error {
+	tried := make(map[*polyEndpoint]bool)
+	ep := start
+	var err error
+	for ep != nil {
+		tried[ep] = true
+		err = f(ep.sdk)
+		if !isPolyTransportError(err) {
+			this.report(ep, nil)
+			return err
+		}
+		this.report(ep, err)
+		log.Warnf("PolyClient - call to %s failed: %v", ep.url, err)
+		this.lock.RLock()
+		ep = this.best(tried)
+		this.lock.RUnlock()
+	}
+	return err
+}
+
+func (this *PolyClient) read(f func(polySdk *sdk.PolySdk) error) error {
+	this.lock.RLock()
+	ep := this.current
+	this.lock.RUnlock()
+	return this.do(ep, f)
+}
+
+// send signs the transaction built by newTx and submits it to the sticky
+// endpoint. Another endpoint is only tried when no connection could be made,
+// once the tx may have reached a node it is never submitted again.
+func (this *PolyClient) send(newTx func(polySdk *sdk.PolySdk) (*types.Transaction, error), signer *sdk.Account) (common.Uint256, error) {
+	this.lock.RLock()
+	ep := this.sticky
+	this.lock.RUnlock()
+	tx, err := newTx(ep.sdk)
+	if err != nil {
+		return common.UINT256_EMPTY, err
+	}
+	if err = ep.sdk.SignToTransaction(tx, signer); err != nil {
+		return common.UINT256_EMPTY, err
+	}
+	tried := make(map[*polyEndpoint]bool)
+	for {
+		tried[ep] = true
+		hash, err := this.sendRawTransaction(ep, tx)
+		var rpcErr *PolyRpcError
+		if err == nil || errors.As(err, &rpcErr) {
+			this.report(ep, nil)
+			return hash, err
+		}
+		this.report(ep, err)
+		var notSent *polyNotSentError
+		if !errors.As(err, &notSent) {
+			return hash, err
+		}
+		this.lock.RLock()
+		next := this.best(tried)
+		this.lock.RUnlock()
+		if next == nil {
+			return hash, err
+		}
+		txHash := tx.Hash()
+		log.Warnf("PolyClient - failed to connect %s, send tx %s to %s: %v", ep.url, txHash.ToHexString(), next.url, err)
+		ep = next
+	}
+}
+
+func (this *PolyClient) sendRawTransaction(ep *polyEndpoint, tx *types.Transaction) (common.Uint256, error) {
+	sink := new(common.ZeroCopySink)
+	if err := tx.Serialization(sink); err != nil {
+		return common.UINT256_EMPTY, fmt.Errorf("serialize error:%s", err)
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      "1",
+		"method":  "sendrawtransaction",
+		"params":  []interface{}{hex.EncodeToString(sink.Bytes())},
+	})
+	if err != nil {
+		return common.UINT256_EMPTY, err
+	}
+	connected := false
+	ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) { connected = true },
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.url, bytes.NewReader(data))
+	if err != nil {
+		return common.UINT256_EMPTY, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := this.http.Do(req)
+	if err != nil {
+		if !connected {
+			return common.UINT256_EMPTY, &polyNotSentError{err}
+		}
+		return common.UINT256_EMPTY, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return common.UINT256_EMPTY, fmt.Errorf("read rpc response body error:%s", err)
+	}
+	rsp := &struct {
+		Error  int64           `json:"error"`
+		Desc   string          `json:"desc"`
+		Result json.RawMessage `json:"result"`
+	}{}
+	if err = json.Unmarshal(body, rsp); err != nil {
+		return common.UINT256_EMPTY, fmt.Errorf("json.Unmarshal JsonRpcResponse:%s error:%s", body, err)
+	}
+	if rsp.Error != 0 {
+		return common.UINT256_EMPTY, &PolyRpcError{Code: rsp.Error, Desc: rsp.Desc, Result: string(rsp.Result)}
+	}
+	return sdkutils.GetUint256(rsp.Result)
+}
+
+func (this *PolyClient) CreateWallet(walletFile string) (*sdk.Wallet, error) {
+	return this.endpoints[0].sdk.CreateWallet(walletFile)
+}
+
+func (this *PolyClient) OpenWallet(walletFile string) (*sdk.Wallet, error) {
+	return this.endpoints[0].sdk.OpenWallet(walletFile)
+}
+
+func (this *PolyClient) GetCurrentBlockHeight() (height uint32, err error) {
+	err = this.read(func(polySdk *sdk.PolySdk) error {
+		height, err = polySdk.GetCurrentBlockHeight()
+		return err
+	})
+	return
+}
+
+func (this *PolyClient) GetBlockHeightByTxHash(txHash string) (height uint32, err error) {
+	err = this.read(func(polySdk *sdk.PolySdk) error {
+		height, err = polySdk.GetBlockHeightByTxHash(txHash)
+		return err
+	})
+	return
+}
+
+func (this *PolyClient) GetStorage(contractAddress string, key []byte) (value []byte, err error) {
+	err = this.read(func(polySdk *sdk.PolySdk) error {
+		value, err = polySdk.GetStorage(contractAddress, key)
+		return err
+	})
+	return
+}
+
+func (this *PolyClient) GetSmartContractEvent(txHash string) (event *sdkcom.SmartContactEvent, err error) {
+	err = this.read(func(polySdk *sdk.PolySdk) error {
+		event, err = polySdk.GetSmartContractEvent(txHash)
+		return err
+	})
+	return
+}
+
+func (this *PolyClient) GetSmartContractEventByBlock(height uint32) (events []*sdkcom.SmartContactEvent, err error) {
+	err = this.read(func(polySdk *sdk.PolySdk) error {
+		events, err = polySdk.GetSmartContractEventByBlock(height)
+		return err
+	})
+	return
+}
+
+func (this *PolyClient) GetHeaderByHeight(height uint32) (hdr *types.Header, err error) {
+	err = this.read(func(polySdk *sdk.PolySdk) error {
+		hdr, err = polySdk.GetHeaderByHeight(height)
+		return err
+	})
+	return
+}
+
+func (this *PolyClient) GetMerkleProof(blockHeight, rootHeight uint32) (proof *sdkcom.MerkleProof, err error) {
+	err = this.read(func(polySdk *sdk.PolySdk) error {
+		proof, err = polySdk.GetMerkleProof(blockHeight, rootHeight)
+		return err
+	})
+	return
+}
+
+func (this *PolyClient) GetCrossStatesProof(height uint32, key string) (proof *sdkcom.MerkleProof, err error) {
+	err = this.read(func(polySdk *sdk.PolySdk) error {
+		proof, err = polySdk.GetCrossStatesProof(height, key)
+		return err
+	})
+	return
+}
+
+func (this *PolyClient) SyncBlockHeader(chainId uint64, address common.Address, headers [][]byte, signer *sdk.Account) (common.Uint256, error) {
+	return this.send(func(polySdk *sdk.PolySdk) (*types.Transaction, error) {
+		return polySdk.Native.Hs.NewSyncBlockHeaderTransaction(chainId, address, headers)
+	}, signer)
+}
+
+func (this *PolyClient) ImportOuterTransfer(sourceChainId uint64, txData []byte, height uint32, proof []byte,
+	relayerAddress []byte, HeaderOrCrossChainMsg []byte, signer *sdk.Account) (common.Uint256, error) {
+	return this.send(func(polySdk *sdk.PolySdk) (*types.Transaction, error) {
+		return polySdk.Native.Ccm.NewImportOuterTransferTransaction(sourceChainId, txData, height, proof, relayerAddress, HeaderOrCrossChainMsg)
+	}, signer)
+}
+
+// Degraded tells if the poly head has stalled, work depending on poly should pause
+func (this *PolyClient) Degraded() bool {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.head.degraded
+}
+
+func (this *PolyClient) Status() *ChainStatus {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	status := this.head.status()
+	for _, ep := range this.endpoints {
+		status.Endpoints = append(status.Endpoints, &EndpointStatus{
+			Url:     ep.url,
+			Height:  uint64(ep.height),
+			ErrRate: ep.errRate,
+		})
+	}
+	return status
+}
+
+// CheckHealth fails when the poly head stalled or no endpoint is healthy
+func (this *PolyClient) CheckHealth() error {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	if this.head.degraded {
+		return fmt.Errorf("poly head stalled at %d since %s", this.head.height, this.head.lastProgress.Format(time.RFC3339))
+	}
+	maxHeight := this.maxHeight()
+	for _, ep := range this.endpoints {
+		if this.healthy(ep, maxHeight) {
+			return nil
+		}
+	}
+	return fmt.Errorf("no healthy poly endpoint")
+}
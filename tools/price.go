@@ -0,0 +1,122 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const price_cache_time = time.Minute
+
+// PriceSource gives the price of one HT in the unit fees are paid in
+type PriceSource interface {
+	Price() (*big.Float, error)
+}
+
+type StaticPrice struct {
+	price *big.Float
+}
+
+func NewStaticPrice(price string) (*StaticPrice, error) {
+	p, ok := new(big.Float).SetString(price)
+	if !ok {
+		return nil, fmt.Errorf("invalid price %s", price)
+	}
+	return &StaticPrice{price: p}, nil
+}
+
+func (this *StaticPrice) Price() (*big.Float, error) {
+	return new(big.Float).Set(this.price), nil
+}
+
+// HTTPPrice reads the price from a JSON api, path is the dot separated
+// field holding it, e.g. "data.price". The price is cached for a minute.
+type HTTPPrice struct {
+	url     string
+	path    []string
+	client  *http.Client
+	price   *big.Float
+	updated time.Time
+	lock    sync.Mutex
+}
+
+func NewHTTPPrice(url string, path string) *HTTPPrice {
+	return &HTTPPrice{
+		url:    url,
+		path:   strings.Split(path, "."),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (this *HTTPPrice) Price() (*big.Float, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.price != nil && time.Since(this.updated) < price_cache_time {
+		return new(big.Float).Set(this.price), nil
+	}
+	price, err := this.fetch()
+	if err != nil {
+		return nil, err
+	}
+	this.price = price
+	this.updated = time.Now()
+	return new(big.Float).Set(price), nil
+}
+
+func (this *HTTPPrice) fetch() (*big.Float, error) {
+	resp, err := this.client.Get(this.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("response status code: %d", resp.StatusCode)
+	}
+	var v interface{}
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	for _, field := range this.path {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("no field %s in price response", field)
+		}
+		v = obj[field]
+	}
+	var raw string
+	switch p := v.(type) {
+	case json.Number:
+		raw = p.String()
+	case string:
+		raw = p
+	default:
+		return nil, fmt.Errorf("price in response is not a number: %v", v)
+	}
+	price, ok := new(big.Float).SetString(raw)
+	if !ok || price.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid price %s", raw)
+	}
+	return price, nil
+}
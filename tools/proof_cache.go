@@ -0,0 +1,144 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package tools
+
+import (
+	"strings"
+	"sync"
+)
+
+const max_cached_proofs = 10000
+
+type proofSlot struct {
+	contract string
+	key      string
+}
+
+type proofCacheKey struct {
+	proofSlot
+	height uint64
+}
+
+type CachedProof struct {
+	Height    uint64
+	BlockHash []byte // hash of the header synced to poly at Height
+	Proof     []byte
+}
+
+// ProofCache keeps the proofs fetched for each (contract, storage key,
+// height), so a failed commit can be retried with a proof already fetched.
+type ProofCache struct {
+	proofs  map[proofCacheKey]*CachedProof
+	heights map[proofSlot]map[uint64]bool // heights cached for each (contract, storage key)
+	lock    sync.Mutex
+}
+
+func NewProofCache() *ProofCache {
+	return &ProofCache{
+		proofs:  make(map[proofCacheKey]*CachedProof),
+		heights: make(map[proofSlot]map[uint64]bool),
+	}
+}
+
+func newProofSlot(contract string, key string) proofSlot {
+	return proofSlot{strings.ToLower(contract), key}
+}
+
+func (this *ProofCache) Get(contract string, key string, height uint64) (*CachedProof, bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	p, ok := this.proofs[proofCacheKey{newProofSlot(contract, key), height}]
+	return p, ok
+}
+
+// Latest returns the cached proof of (contract, key) with the highest height
+// in (above, upTo]
+func (this *ProofCache) Latest(contract string, key string, above uint64, upTo uint64) (*CachedProof, bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	slot := newProofSlot(contract, key)
+	var (
+		best  uint64
+		found bool
+	)
+	for h := range this.heights[slot] {
+		if h > above && h <= upTo && (!found || h > best) {
+			best, found = h, true
+		}
+	}
+	if !found {
+		return nil, false
+	}
+	return this.proofs[proofCacheKey{slot, best}], true
+}
+
+func (this *ProofCache) Put(contract string, key string, proof *CachedProof) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	k := proofCacheKey{newProofSlot(contract, key), proof.Height}
+	if _, ok := this.proofs[k]; !ok && len(this.proofs) >= max_cached_proofs {
+		// drop the proof with the lowest height, it is the least likely to be reused
+		var (
+			oldest proofCacheKey
+			found  bool
+		)
+		for ck := range this.proofs {
+			if !found || ck.height < oldest.height {
+				oldest, found = ck, true
+			}
+		}
+		this.remove(oldest)
+	}
+	this.proofs[k] = proof
+	if this.heights[k.proofSlot] == nil {
+		this.heights[k.proofSlot] = make(map[uint64]bool)
+	}
+	this.heights[k.proofSlot][k.height] = true
+}
+
+// Remove drops the proof of (contract, key) at height
+func (this *ProofCache) Remove(contract string, key string, height uint64) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.remove(proofCacheKey{newProofSlot(contract, key), height})
+}
+
+// RemoveAll drops the proofs of (contract, key) at all heights
+func (this *ProofCache) RemoveAll(contract string, key string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	slot := newProofSlot(contract, key)
+	for h := range this.heights[slot] {
+		delete(this.proofs, proofCacheKey{slot, h})
+	}
+	delete(this.heights, slot)
+}
+
+func (this *ProofCache) remove(k proofCacheKey) {
+	delete(this.proofs, k)
+	if heights := this.heights[k.proofSlot]; heights != nil {
+		delete(heights, k.height)
+		if len(heights) == 0 {
+			delete(this.heights, k.proofSlot)
+		}
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/btcsuite/btcd/btcec"
+	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
@@ -31,6 +32,7 @@ import (
 	"github.com/ontio/ontology-crypto/keypair"
 	"github.com/ontio/ontology-crypto/sm2"
 	"github.com/polynetwork/poly/common"
+	"github.com/polynetwork/poly/native/service/cross_chain_manager/eth"
 	"math/big"
 	"strconv"
 	"strings"
@@ -190,6 +192,33 @@ func GetProof(url string, contractAddress string, key string, blockheight string
 	return result, nil
 }
 
+// VerifyProof checks an eth_getProof result the same way poly does: the account
+// proof against the state root of header, the storage proof against the
+// account's storage hash, and the stored value against keccak256(value).
+func VerifyProof(rawProof []byte, header *types.Header, contractAddress string, key string, value []byte) error {
+	proof := &eth.ETHProof{}
+	if err := json.Unmarshal(rawProof, proof); err != nil {
+		return fmt.Errorf("VerifyProof, unmarshal proof err: %s", err)
+	}
+	if len(proof.StorageProofs) != 1 {
+		return fmt.Errorf("VerifyProof, incorrect proof format")
+	}
+	if ethcommon.HexToHash(proof.StorageProofs[0].Key) != ethcommon.HexToHash(key) {
+		return fmt.Errorf("VerifyProof, storage key %s in proof is not the requested %s", proof.StorageProofs[0].Key, key)
+	}
+	result, err := eth.VerifyMerkleProof(proof, header, ethcommon.HexToAddress(contractAddress).Bytes())
+	if err != nil {
+		return fmt.Errorf("VerifyProof, %s", err)
+	}
+	if result == nil {
+		return fmt.Errorf("VerifyProof, verify merkle proof failed")
+	}
+	if !eth.CheckProofResult(result, value) {
+		return fmt.Errorf("VerifyProof, proof value %x is not the hash of cross chain event data", result)
+	}
+	return nil
+}
+
 func EncodeBigInt(b *big.Int) string {
 	if b.Uint64() == 0 {
 		return "00"
@@ -0,0 +1,90 @@
+/*
+* Copyright (C) 2020 The poly network Authors
+* This file is part of The poly network library.
+*
+* The poly network is free software: you can redistribute it and/or modify
+* it under the terms of the GNU Lesser General Public License as published by
+* the Free Software Foundation, either version 3 of the License, or
+* (at your option) any later version.
+*
+* The poly network is distributed in the hope that it will be useful,
+* but WITHOUT ANY WARRANTY; without even the implied warranty of
+* MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+* GNU Lesser General Public License for more details.
+* You should have received a copy of the GNU Lesser General Public License
+* along with The poly network . If not, see <http://www.gnu.org/licenses/>.
+ */
+package tools
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/polynetwork/heco_relayer/log"
+	"github.com/polynetwork/heco_relayer/notify"
+)
+
+type EndpointStatus struct {
+	Url     string
+	Height  uint64
+	ErrRate float64
+	Latency string `json:",omitempty"`
+}
+
+type ChainStatus struct {
+	Chain        string
+	Height       uint64
+	LastProgress time.Time
+	Degraded     bool
+	Endpoints    []*EndpointStatus
+}
+
+// headTracker marks a chain as degraded when the highest head among its
+// endpoints hasn't advanced for timeout, and recovers once it moves again.
+// It is not thread safe, callers hold their own lock.
+type headTracker struct {
+	chain        string
+	timeout      time.Duration
+	height       uint64
+	lastProgress time.Time
+	degraded     bool
+}
+
+func newHeadTracker(chain string, timeout time.Duration) *headTracker {
+	return &headTracker{
+		chain:        chain,
+		timeout:      timeout,
+		lastProgress: time.Now(),
+	}
+}
+
+func (this *headTracker) update(height uint64) {
+	if height > this.height {
+		this.height = height
+		this.lastProgress = time.Now()
+		if this.degraded {
+			this.degraded = false
+			log.Infof("watchdog - %s head advanced to %d, resume", this.chain, height)
+		}
+		return
+	}
+	if !this.degraded && time.Since(this.lastProgress) > this.timeout {
+		this.degraded = true
+		log.Errorf("watchdog - %s head stalled at %d for %s, pause dependent work", this.chain, this.height,
+			time.Since(this.lastProgress).Round(time.Second).String())
+		notify.Notify(&notify.Event{
+			Kind:    notify.EVENT_SYNC_STALLED,
+			Subject: this.chain,
+			Message: fmt.Sprintf("%s head stalled at %d since %s", this.chain, this.height, this.lastProgress.Format(time.RFC3339)),
+		})
+	}
+}
+
+func (this *headTracker) status() *ChainStatus {
+	return &ChainStatus{
+		Chain:        this.chain,
+		Height:       this.height,
+		LastProgress: this.lastProgress,
+		Degraded:     this.degraded,
+	}
+}